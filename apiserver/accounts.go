@@ -0,0 +1,75 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	proxyman_command "github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/common/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	errInboundNotFound     = errors.New("inbound not found")
+	errUnsupportedProtocol = errors.New("protocol does not support user management")
+)
+
+// inboundProtocol looks up the protocol of the inbound identified by tag through ListInbounds.
+func (s *APIServer) inboundProtocol(ctx context.Context, tag string) (string, error) {
+	resp, err := s.xrayClient.HandlerClient.ListInbounds(ctx, &proxyman_command.ListInboundsRequest{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list inbounds: %w", err)
+	}
+
+	for _, inbound := range resp.GetInbounds() {
+		if inbound.Tag != tag {
+			continue
+		}
+		proxyType := inbound.GetProxySettings().GetType()
+		if adapter, ok := userInboundAdapter(proxyType); ok {
+			return adapter.Name(), nil
+		}
+		return "", fmt.Errorf("inbound %s (%s): %w", tag, proxyType, errUnsupportedProtocol)
+	}
+
+	return "", fmt.Errorf("inbound %s: %w", tag, errInboundNotFound)
+}
+
+// inboundProtocolErrorStatus maps an inboundProtocol error to an HTTP status code.
+func inboundProtocolErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInboundNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errUnsupportedProtocol):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// buildAccount builds the account message of a user for the given inbound protocol.
+func buildAccount(protocolName string, user SimplifiedUser) (proto.Message, error) {
+	adapter, err := accountAdapterByName(protocolName)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.BuildAccount(user)
+}
+
+// sameAccount reports whether an account held by Xray-core carries the credentials of the desired user.
+func sameAccount(existing *protocol.User, desired SimplifiedUser) bool {
+	if existing.Account == nil {
+		return false
+	}
+	adapter, ok := accountAdapterByType(existing.Account.Type)
+	if !ok {
+		return false
+	}
+	instance, err := existing.Account.GetInstance()
+	if err != nil {
+		return false
+	}
+	return adapter.SameAccount(instance, desired)
+}
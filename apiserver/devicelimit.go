@@ -0,0 +1,331 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	gonet "net"
+	"net/http"
+	"sort"
+	"time"
+
+	router_command "github.com/xtls/xray-core/app/router/command"
+	"github.com/xtls/xray-core/common/net"
+
+	"xray-api-bridge/store"
+)
+
+// Actions taken when a user is online from more source IPs than allowed.
+const (
+	deviceLimitActionLog     = "log"
+	deviceLimitActionWebhook = "webhook"
+	deviceLimitActionKick    = "kick"
+	deviceLimitActionBlock   = "block"
+)
+
+// defaultDeviceLimitDuration is how long a kick or a block lasts unless the limit says otherwise.
+const defaultDeviceLimitDuration = 5 * time.Minute
+
+// DeviceLimitOptions configures the device limit enforcer.
+type DeviceLimitOptions struct {
+	// WebhookURL receives a POST with a DeviceLimitEvent for the webhook action.
+	WebhookURL string
+	// BlockOutboundTag is the outbound that blocked source IPs are routed to.
+	BlockOutboundTag string
+}
+
+// deviceLimitState is what the enforcer remembers between polls. It is only used under deviceMu.
+type deviceLimitState struct {
+	// firstSeen records when each source IP of a user first showed up, to tell which IPs are newest.
+	firstSeen map[string]map[string]time.Time
+	// violating holds the users already acted upon for their current violation.
+	violating map[string]bool
+}
+
+// RunDeviceLimitEnforcer checks the online source IPs of users with a device limit every interval,
+// until ctx is cancelled.
+func (s *APIServer) RunDeviceLimitEnforcer(ctx context.Context, interval time.Duration, opts DeviceLimitOptions) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	state := &deviceLimitState{
+		firstSeen: make(map[string]map[string]time.Time),
+		violating: make(map[string]bool),
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.enforceDeviceLimits(ctx, opts, state)
+		}
+	}
+}
+
+// enforceDeviceLimits lifts kicks and blocks that ran out, then acts on every user newly found
+// online from more source IPs than allowed.
+func (s *APIServer) enforceDeviceLimits(ctx context.Context, opts DeviceLimitOptions, state *deviceLimitState) {
+	s.deviceMu.Lock()
+	defer s.deviceMu.Unlock()
+
+	now := time.Now()
+	limits := s.store.DeviceLimits.List()
+	for i := range limits {
+		if s.liftDeviceLimitActions(ctx, &limits[i], now, false) {
+			if err := s.store.DeviceLimits.Put(limits[i]); err != nil {
+				log.Printf("Warning: failed to persist device limit of user %s: %v", limits[i].Email, err)
+			}
+		}
+	}
+	if len(limits) == 0 {
+		return
+	}
+
+	online, err := s.listOnlineUsers(ctx)
+	if err != nil {
+		log.Printf("Warning: device limit enforcement skipped: %v", err)
+		return
+	}
+	onlineByEmail := make(map[string]OnlineUser, len(online))
+	for _, user := range online {
+		onlineByEmail[user.Email] = user
+	}
+
+	for _, l := range limits {
+		user := onlineByEmail[l.Email]
+		state.track(l.Email, user.IPs, now)
+
+		if len(user.IPs) <= l.MaxIPs {
+			delete(state.violating, l.Email)
+			continue
+		}
+		if state.violating[l.Email] {
+			continue
+		}
+		state.violating[l.Email] = true
+
+		log.Printf("User %s is online from %d source IPs, over the limit of %d (action: %s)", l.Email, len(user.IPs), l.MaxIPs, l.Action)
+		if s.applyDeviceLimitAction(ctx, opts, &l, user, state.newest(l.Email, user.IPs, len(user.IPs)-l.MaxIPs), now) {
+			if err := s.store.DeviceLimits.Put(l); err != nil {
+				log.Printf("Warning: failed to persist device limit of user %s: %v", l.Email, err)
+			}
+		}
+	}
+}
+
+// applyDeviceLimitAction carries out the action of a violated limit. It reports whether the limit
+// record changed and must be saved.
+func (s *APIServer) applyDeviceLimitAction(ctx context.Context, opts DeviceLimitOptions, l *store.DeviceLimit, user OnlineUser, excess []string, now time.Time) bool {
+	switch l.Action {
+	case deviceLimitActionWebhook:
+		if opts.WebhookURL == "" {
+			log.Printf("Warning: device limit of user %s asks for a webhook, but XRAY_API_BRIDGE_DEVICE_LIMIT_WEBHOOK is not set", l.Email)
+			return false
+		}
+		event := DeviceLimitEvent{
+			Event:  "device_limit_exceeded",
+			Email:  l.Email,
+			MaxIPs: l.MaxIPs,
+			IPs:    user.IPs,
+			Time:   now,
+		}
+		go sendDeviceLimitWebhook(opts.WebhookURL, event)
+		return false
+
+	case deviceLimitActionKick:
+		// The user comes back once the kick is lifted by a later poll
+		if err := s.suspendUser(ctx, l.Email, suspendReasonDeviceLimit); err != nil {
+			log.Printf("Warning: failed to kick user %s: %v", l.Email, err)
+			return false
+		}
+		until := now.Add(l.Duration)
+		l.KickedUntil = &until
+		return true
+
+	case deviceLimitActionBlock:
+		changed := false
+		for _, ip := range excess {
+			block, err := s.blockDeviceIP(ctx, opts, l.Email, ip, now.Add(l.Duration))
+			if err != nil {
+				log.Printf("Warning: failed to block IP %s of user %s: %v", ip, l.Email, err)
+				continue
+			}
+			l.Blocks = append(l.Blocks, block)
+			changed = true
+		}
+		return changed
+	}
+	return false
+}
+
+// blockDeviceIP adds a routing rule sending the traffic of a user from one source IP to the
+// block outbound. The rule is built the same way as for POST /routing/blockip, and appended
+// so the rules of Xray-core's own configuration are kept: Xray-core can only append rules or
+// replace them all, and cannot return existing rules to rebuild the list with. An earlier rule
+// matching the user's traffic, such as a catch-all inboundTag rule, therefore shadows the block,
+// which checkDeviceBlock reports.
+func (s *APIServer) blockDeviceIP(ctx context.Context, opts DeviceLimitOptions, email, ip string, until time.Time) (store.DeviceBlock, error) {
+	ruleTag := fmt.Sprintf("deviceLimit_%s_%s", email, ip)
+	ruleMap := map[string]interface{}{
+		"ruleTag":     ruleTag,
+		"user":        []string{email},
+		"source":      []string{ip},
+		"outboundTag": opts.BlockOutboundTag,
+	}
+	rawRule, err := json.Marshal(ruleMap)
+	if err != nil {
+		return store.DeviceBlock{}, fmt.Errorf("failed to marshal rule map: %w", err)
+	}
+	typedConfig, err := newRuleConfig(rawRule)
+	if err != nil {
+		return store.DeviceBlock{}, fmt.Errorf("failed to parse routing rule: %w", err)
+	}
+	if _, err := s.xrayClient.RouterClient.AddRule(ctx, &router_command.AddRuleRequest{Config: typedConfig, ShouldAppend: true}); err != nil {
+		return store.DeviceBlock{}, err
+	}
+
+	// Keep the rule across Xray-core restarts until the block is lifted
+	storeObject(s.store.Rules, "routing rule", ruleTag, rawRule)
+	s.checkDeviceBlock(ctx, opts, email, ip)
+	return store.DeviceBlock{IP: ip, RuleTag: ruleTag, Until: until}, nil
+}
+
+// checkDeviceBlock asks Xray-core to route the traffic of a user from a blocked source IP, on
+// every inbound holding the user, and warns when an earlier rule sends it elsewhere than the block
+// outbound. Only rules matching on user, source, inbound and network are taken into account.
+func (s *APIServer) checkDeviceBlock(ctx context.Context, opts DeviceLimitOptions, email, ip string) {
+	sourceIP := gonet.ParseIP(ip)
+	if sourceIP == nil {
+		return
+	}
+	if v4 := sourceIP.To4(); v4 != nil {
+		sourceIP = v4
+	}
+	accounts, err := s.findUserAccounts(ctx, email)
+	if err != nil {
+		return
+	}
+
+	for _, account := range accounts {
+		route, err := s.xrayClient.RouterClient.TestRoute(ctx, &router_command.TestRouteRequest{
+			RoutingContext: &router_command.RoutingContext{
+				InboundTag: account.tag,
+				Network:    net.Network_TCP,
+				SourceIPs:  [][]byte{sourceIP},
+				User:       email,
+			},
+			FieldSelectors: []string{"outbound"},
+		})
+		if err != nil {
+			continue
+		}
+		if route.GetOutboundTag() != opts.BlockOutboundTag {
+			log.Printf("Warning: an earlier routing rule sends traffic of user %s from %s on inbound %s to outbound '%s', so the device limit block has no effect. Route that traffic without a rule ahead of the block rules, e.g. through the default outbound.", email, ip, account.tag, route.GetOutboundTag())
+		}
+	}
+}
+
+// liftDeviceLimitActions ends the kick and the blocks of a limit that ran out, or all of them when
+// force is set. It reports whether the limit record changed and must be saved.
+func (s *APIServer) liftDeviceLimitActions(ctx context.Context, l *store.DeviceLimit, now time.Time, force bool) bool {
+	changed := false
+	if l.KickedUntil != nil && (force || !now.Before(*l.KickedUntil)) {
+		if err := s.resumeUser(ctx, l.Email, suspendReasonDeviceLimit); err != nil {
+			log.Printf("Warning: failed to end kick of user %s: %v", l.Email, err)
+		} else {
+			l.KickedUntil = nil
+			changed = true
+		}
+	}
+
+	remaining := l.Blocks[:0]
+	for _, block := range l.Blocks {
+		if !force && now.Before(block.Until) {
+			remaining = append(remaining, block)
+			continue
+		}
+		if _, err := s.xrayClient.RouterClient.RemoveRule(ctx, &router_command.RemoveRuleRequest{RuleTag: block.RuleTag}); err != nil {
+			log.Printf("Warning: failed to remove block rule %s: %v", block.RuleTag, err)
+		}
+		unstoreObject(s.store.Rules, "routing rule", block.RuleTag)
+		changed = true
+	}
+	l.Blocks = remaining
+	return changed
+}
+
+// sendDeviceLimitWebhook posts a device limit event to the configured webhook.
+func sendDeviceLimitWebhook(url string, event DeviceLimitEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: failed to encode device limit event: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Warning: device limit webhook failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Warning: device limit webhook answered %s", resp.Status)
+	}
+}
+
+// track records the source IPs of a user seen in this poll and forgets those gone offline.
+func (st *deviceLimitState) track(email string, ips []OnlineIP, now time.Time) {
+	if len(ips) == 0 {
+		delete(st.firstSeen, email)
+		return
+	}
+
+	seen := make(map[string]time.Time, len(ips))
+	for _, ip := range ips {
+		if first, ok := st.firstSeen[email][ip.IP]; ok {
+			seen[ip.IP] = first
+		} else {
+			seen[ip.IP] = now
+		}
+	}
+	st.firstSeen[email] = seen
+}
+
+// newest returns the n source IPs of a user that showed up last. IPs that showed up in the same
+// poll are ordered by when they were last seen.
+func (st *deviceLimitState) newest(email string, ips []OnlineIP, n int) []string {
+	sorted := make([]OnlineIP, len(ips))
+	copy(sorted, ips)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		fi, fj := st.firstSeen[email][sorted[i].IP], st.firstSeen[email][sorted[j].IP]
+		if !fi.Equal(fj) {
+			return fi.After(fj)
+		}
+		return sorted[i].LastSeen.After(sorted[j].LastSeen)
+	})
+
+	newest := make([]string, 0, n)
+	for i := 0; i < n && i < len(sorted); i++ {
+		newest = append(newest, sorted[i].IP)
+	}
+	return newest
+}
+
+// newDeviceLimitResponse converts a stored device limit into its API representation.
+func newDeviceLimitResponse(l store.DeviceLimit) DeviceLimitResponse {
+	resp := DeviceLimitResponse{
+		Email:       l.Email,
+		MaxIPs:      l.MaxIPs,
+		Action:      l.Action,
+		Duration:    l.Duration.String(),
+		KickedUntil: l.KickedUntil,
+		BlockedIPs:  make([]BlockedIPResponse, 0, len(l.Blocks)),
+	}
+	for _, block := range l.Blocks {
+		resp.BlockedIPs = append(resp.BlockedIPs, BlockedIPResponse{IP: block.IP, Until: block.Until})
+	}
+	return resp
+}
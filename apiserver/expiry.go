@@ -0,0 +1,90 @@
+package apiserver
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"xray-api-bridge/store"
+)
+
+// RunExpiryScheduler suspends users past their expiry date every interval, until ctx is cancelled.
+func (s *APIServer) RunExpiryScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.expireUsers(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.expireUsers(ctx)
+		}
+	}
+}
+
+// expireUsers suspends every user whose expiry date has passed and records when it happened.
+func (s *APIServer) expireUsers(ctx context.Context) {
+	s.expiryMu.Lock()
+	defer s.expiryMu.Unlock()
+
+	now := time.Now()
+	for _, e := range s.store.Expiries.List() {
+		if e.ExpiredAt != nil || now.Before(e.ExpireAt) {
+			continue
+		}
+		if err := s.suspendUser(ctx, e.Email, suspendReasonExpired); err != nil {
+			log.Printf("Warning: failed to suspend expired user %s: %v", e.Email, err)
+			continue
+		}
+		e.ExpiredAt = &now
+		if err := s.store.Expiries.Put(e); err != nil {
+			log.Printf("Warning: failed to persist expiry of user %s: %v", e.Email, err)
+		}
+	}
+}
+
+// setUserExpiry sets the expiry date of a user. A user suspended for being expired is put back.
+func (s *APIServer) setUserExpiry(ctx context.Context, email string, expireAt time.Time) error {
+	s.expiryMu.Lock()
+	defer s.expiryMu.Unlock()
+
+	if err := s.store.Expiries.Put(store.Expiry{Email: email, ExpireAt: expireAt}); err != nil {
+		return err
+	}
+	return s.resumeUser(ctx, email, suspendReasonExpired)
+}
+
+// removeUserExpiry drops the expiry date of a user. A user suspended for being expired is put back.
+func (s *APIServer) removeUserExpiry(ctx context.Context, email string) error {
+	s.expiryMu.Lock()
+	defer s.expiryMu.Unlock()
+
+	if err := s.store.Expiries.Delete(email); err != nil {
+		return err
+	}
+	return s.resumeUser(ctx, email, suspendReasonExpired)
+}
+
+// storeExpiries records the expiry dates given along with users added to an inbound.
+func (s *APIServer) storeExpiries(ctx context.Context, users ...SimplifiedUser) {
+	for _, u := range users {
+		if u.ExpireAt == nil {
+			continue
+		}
+		if err := s.setUserExpiry(ctx, u.Email, *u.ExpireAt); err != nil {
+			log.Printf("Warning: failed to persist expiry of user %s: %v", u.Email, err)
+		}
+	}
+}
+
+// newUserExpiryResponse converts a stored expiry into its API representation.
+func newUserExpiryResponse(e store.Expiry) UserExpiryResponse {
+	return UserExpiryResponse{
+		Email:     e.Email,
+		ExpireAt:  e.ExpireAt,
+		Expired:   !time.Now().Before(e.ExpireAt),
+		ExpiredAt: e.ExpiredAt,
+	}
+}
@@ -1,18 +1,19 @@
 package apiserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	proxyman_command "github.com/xtls/xray-core/app/proxyman/command"
 	"github.com/xtls/xray-core/common"
 	"github.com/xtls/xray-core/common/protocol"
-	"github.com/xtls/xray-core/common/serial"
 	"github.com/xtls/xray-core/infra/conf"
 	"strings"
-	vless "github.com/xtls/xray-core/proxy/vless"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -20,8 +21,15 @@ import (
 // handleAddInbound handles the POST /inbound API request.
 func (s *APIServer) handleAddInbound() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Keep the raw body around so the inbound can be restored exactly as submitted
+		var rawInbound json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&rawInbound); err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+
 		var inboundConfig conf.InboundDetourConfig
-		if err := json.NewDecoder(r.Body).Decode(&inboundConfig); err != nil {
+		if err := json.Unmarshal(rawInbound, &inboundConfig); err != nil {
 			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
 			return
 		}
@@ -42,6 +50,8 @@ func (s *APIServer) handleAddInbound() http.HandlerFunc {
 			return
 		}
 
+		storeObject(s.store.Inbounds, "inbound", inboundConfig.Tag, rawInbound)
+
 		RespondWithJSON(w, http.StatusCreated, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("Inbound '%s' added successfully", inboundConfig.Tag)})
 	}
 }
@@ -55,64 +65,53 @@ func (s *APIServer) handleAlterInbound() http.HandlerFunc {
 			return
 		}
 
-		// For now, we only support adding a VLESS user.
-		// A more robust implementation would inspect the request to decide whether to add/remove
-		// and for which protocol.
-		var simpleUser struct {
-			ID    string `json:"id"`
-			Email string `json:"email"`
-			Flow  string `json:"flow"`
-			Level uint32 `json:"level"`
-		}
+		// For now, we only support adding a user.
+		// A more robust implementation would inspect the request to decide whether to add or remove.
+		var simpleUser SimplifiedUser
 
 		if err := json.NewDecoder(r.Body).Decode(&simpleUser); err != nil {
-			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body for VLESS user: %v", err))
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body for user: %v", err))
 			return
 		}
 
-		// 1. Create the vless.Account from the simple user data
-		vlessAccount := &vless.Account{
-			Id:   simpleUser.ID,
-			Flow: simpleUser.Flow,
-		}
-
-		// 2. Serialize the vless.Account into a serial.TypedMessage
-		typedAccount := serial.ToTypedMessage(vlessAccount)
-
-		// 3. Create the main protocol.User
-		protoUser := &protocol.User{
-			Level:   simpleUser.Level,
-			Email:   simpleUser.Email,
-			Account: typedAccount,
+		// The account type depends on the protocol of the inbound
+		protocolName, err := s.inboundProtocol(r.Context(), tag)
+		if err != nil {
+			RespondWithError(w, inboundProtocolErrorStatus(err), fmt.Sprintf("Failed to determine inbound protocol: %v", err))
+			return
 		}
-
-		// 4. Create the AddUserOperation
-		operation := &proxyman_command.AddUserOperation{
-			User: protoUser,
+		if err := validateUser(protocolName, simpleUser); err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
 		}
-
-		// 5. Serialize the operation into the final TypedMessage for AlterInbound
-		typedOperation := serial.ToTypedMessage(operation)
-
-		// 6. Create and send the AlterInboundRequest
-		req := &proxyman_command.AlterInboundRequest{
-			Tag:       tag,
-			Operation: typedOperation,
+		if err := s.suspendedUserError(simpleUser); err != nil {
+			RespondWithError(w, http.StatusConflict, err.Error())
+			return
 		}
 
-		_, err := s.xrayClient.HandlerClient.AlterInbound(r.Context(), req)
-		if err != nil {
+		if err := s.addInboundUser(r.Context(), tag, protocolName, simpleUser); err != nil {
 			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to alter inbound: %v", err))
 			return
 		}
 
+		// Keep the user so it can be restored after Xray-core restarts
+		s.storeUsers(tag, protocolName, simpleUser)
+		s.storeExpiries(r.Context(), simpleUser)
+		s.assignUserShortIDs(r.Context(), tag, simpleUser)
+
 		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: "Inbound altered successfully"})
 	}
 }
 
-// handleListInbounds handles the GET /inbound API request.
+// handleListInbounds handles the GET /inbound?view=<raw> API request.
 func (s *APIServer) handleListInbounds() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		view, err := parseConfigView(r.URL.Query().Get("view"))
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		req := &proxyman_command.ListInboundsRequest{}
 
 		resp, err := s.xrayClient.HandlerClient.ListInbounds(r.Context(), req)
@@ -121,19 +120,36 @@ func (s *APIServer) handleListInbounds() http.HandlerFunc {
 			return
 		}
 
+		if view == configViewRaw {
+			var warnings []ItemWarning
+			rawInbounds := make([]interface{}, 0, len(resp.GetInbounds()))
+			for _, inbound := range resp.GetInbounds() {
+				rawInbound, err := rawProtoJSON(inbound)
+				if err != nil {
+					warnings = append(warnings, ItemWarning{Tag: inbound.Tag, Warning: fmt.Sprintf("Failed to encode inbound: %v", err)})
+					continue
+				}
+				rawInbounds = append(rawInbounds, rawInbound)
+			}
+			RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: rawInbounds, Warnings: warnings})
+			return
+		}
+
 		// Create a new slice for our simplified response
 		simplifiedInbounds := make([]*conf.InboundDetourConfig, 0, len(resp.GetInbounds()))
 
+		// An inbound that cannot be reverse mapped is left out with a warning rather than failing the listing
+		var warnings []ItemWarning
 		for _, inbound := range resp.GetInbounds() {
 			confInbound, err := ReverseInbound(inbound)
 			if err != nil {
-				RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reverse map inbound %s: %v", inbound.Tag, err))
-				return
+				warnings = append(warnings, ItemWarning{Tag: inbound.Tag, Warning: fmt.Sprintf("Failed to reverse map inbound: %v", err)})
+				continue
 			}
 			simplifiedInbounds = append(simplifiedInbounds, confInbound)
 		}
 
-		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: simplifiedInbounds})
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: simplifiedInbounds, Warnings: warnings})
 	}
 }
 
@@ -146,14 +162,15 @@ func (s *APIServer) handleAddInboundUsers() http.HandlerFunc {
 			return
 		}
 
-		// Parse request body for users
-		var users []struct {
-			ID    string `json:"id"`
-			Email string `json:"email"`
-			Flow  string `json:"flow"`
-			Level uint32 `json:"level"`
+		mode, err := parseBatchMode(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
 		}
 
+		// Parse request body for users
+		var users []SimplifiedUser
+
 		if err := json.NewDecoder(r.Body).Decode(&users); err != nil {
 			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
 			return
@@ -164,45 +181,66 @@ func (s *APIServer) handleAddInboundUsers() http.HandlerFunc {
 			return
 		}
 
-		// Process each user
+		// The account type depends on the protocol of the inbound
+		protocolName, err := s.inboundProtocol(r.Context(), tag)
+		if err != nil {
+			RespondWithError(w, inboundProtocolErrorStatus(err), fmt.Sprintf("Failed to determine inbound protocol: %v", err))
+			return
+		}
 		for _, user := range users {
-			// Create the vless.Account from the user data
-			vlessAccount := &vless.Account{
-				Id:   user.ID,
-				Flow: user.Flow,
-			}
-
-			// Serialize the vless.Account into a serial.TypedMessage
-			typedAccount := serial.ToTypedMessage(vlessAccount)
-
-			// Create the main protocol.User
-			protoUser := &protocol.User{
-				Level:   user.Level,
-				Email:   user.Email,
-				Account: typedAccount,
+			if err := validateUser(protocolName, user); err != nil {
+				RespondWithError(w, http.StatusBadRequest, err.Error())
+				return
 			}
+		}
+		if err := s.suspendedUserError(users...); err != nil {
+			RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
 
-			// Create the AddUserOperation
-			operation := &proxyman_command.AddUserOperation{
-				User: protoUser,
+		if mode == batchModeBestEffort {
+			results := make([]UserOperationResult, 0, len(users))
+			var added []SimplifiedUser
+			for _, user := range users {
+				err := s.addInboundUser(r.Context(), tag, protocolName, user)
+				results = append(results, newUserOperationResult(user.Email, err))
+				if err == nil {
+					added = append(added, user)
+				}
 			}
+			s.storeUsers(tag, protocolName, added...)
+			s.storeExpiries(r.Context(), added...)
+			s.assignUserShortIDs(r.Context(), tag, added...)
 
-			// Serialize the operation into the final TypedMessage for AlterInbound
-			typedOperation := serial.ToTypedMessage(operation)
-
-			// Create and send the AlterInboundRequest
-			req := &proxyman_command.AlterInboundRequest{
-				Tag:       tag,
-				Operation: typedOperation,
-			}
+			RespondWithBatchResults(w, results, fmt.Sprintf("%d of %d users added to inbound '%s'", len(added), len(users), tag))
+			return
+		}
 
-			_, err := s.xrayClient.HandlerClient.AlterInbound(r.Context(), req)
-			if err != nil {
+		// Process each user
+		for i, user := range users {
+			if err := s.addInboundUser(r.Context(), tag, protocolName, user); err != nil {
+				if mode == batchModeAtomic {
+					// Undo the users added so far, even if the client already went away
+					if rollbackErr := s.rollbackAddedUsers(context.WithoutCancel(r.Context()), tag, users[:i]); rollbackErr != nil {
+						RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add user %s to inbound %s: %v; rollback failed: %v", user.Email, tag, err, rollbackErr))
+						return
+					}
+					RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add user %s to inbound %s: %v; %d previously added users rolled back", user.Email, tag, err, i))
+					return
+				}
+				s.storeUsers(tag, protocolName, users[:i]...)
+				s.storeExpiries(r.Context(), users[:i]...)
+				s.assignUserShortIDs(r.Context(), tag, users[:i]...)
 				RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add user %s to inbound %s: %v", user.Email, tag, err))
 				return
 			}
 		}
 
+		// Keep the users so they can be restored after Xray-core restarts
+		s.storeUsers(tag, protocolName, users...)
+		s.storeExpiries(r.Context(), users...)
+		s.assignUserShortIDs(r.Context(), tag, users...)
+
 		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("%d users added to inbound '%s'", len(users), tag)})
 	}
 }
@@ -216,6 +254,12 @@ func (s *APIServer) handleRemoveInboundUsers() http.HandlerFunc {
 			return
 		}
 
+		mode, err := parseBatchMode(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		// Parse request body for emails to remove
 		var request struct {
 			Emails []string `json:"emails"`
@@ -231,33 +275,168 @@ func (s *APIServer) handleRemoveInboundUsers() http.HandlerFunc {
 			return
 		}
 
-		// Process each email
-		for _, email := range request.Emails {
-			// Create the RemoveUserOperation
-			operation := &proxyman_command.RemoveUserOperation{
-				Email: email,
+		if mode == batchModeBestEffort {
+			results := make([]UserOperationResult, 0, len(request.Emails))
+			var removed []string
+			for _, email := range request.Emails {
+				err := s.removeInboundUser(r.Context(), tag, email)
+				results = append(results, newUserOperationResult(email, err))
+				if err == nil {
+					removed = append(removed, email)
+				}
 			}
+			s.unstoreUsers(tag, removed...)
+			s.forgetRemovedUsers(r.Context(), removed...)
 
-			// Serialize the operation into TypedMessage for AlterInbound
-			typedOperation := serial.ToTypedMessage(operation)
+			RespondWithBatchResults(w, results, fmt.Sprintf("%d of %d users removed from inbound '%s'", len(removed), len(request.Emails), tag))
+			return
+		}
 
-			// Create and send the AlterInboundRequest
-			req := &proxyman_command.AlterInboundRequest{
-				Tag:       tag,
-				Operation: typedOperation,
+		// In atomic mode, keep a copy of every user so removed ones can be added back
+		var snapshots []*protocol.User
+		if mode == batchModeAtomic {
+			for _, email := range request.Emails {
+				resp, err := s.xrayClient.HandlerClient.GetInboundUsers(r.Context(), &proxyman_command.GetInboundUserRequest{Tag: tag, Email: email})
+				if err != nil || len(resp.GetUsers()) == 0 {
+					RespondWithError(w, http.StatusNotFound, fmt.Sprintf("User %s not found in inbound %s, nothing was removed", email, tag))
+					return
+				}
+				snapshots = append(snapshots, resp.GetUsers()[0])
 			}
+		}
 
-			_, err := s.xrayClient.HandlerClient.AlterInbound(r.Context(), req)
-			if err != nil {
+		// Process each email
+		for i, email := range request.Emails {
+			if err := s.removeInboundUser(r.Context(), tag, email); err != nil {
+				if mode == batchModeAtomic {
+					// Add back the users removed so far, even if the client already went away
+					if rollbackErr := s.rollbackRemovedUsers(context.WithoutCancel(r.Context()), tag, snapshots[:i]); rollbackErr != nil {
+						RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove user %s from inbound %s: %v; rollback failed: %v", email, tag, err, rollbackErr))
+						return
+					}
+					RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove user %s from inbound %s: %v; %d previously removed users rolled back", email, tag, err, i))
+					return
+				}
+				s.unstoreUsers(tag, request.Emails[:i]...)
+				s.forgetRemovedUsers(r.Context(), request.Emails[:i]...)
 				RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove user %s from inbound %s: %v", email, tag, err))
 				return
 			}
 		}
 
+		s.unstoreUsers(tag, request.Emails...)
+		s.forgetRemovedUsers(r.Context(), request.Emails...)
+
 		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("%d users removed from inbound '%s'", len(request.Emails), tag)})
 	}
 }
 
+// handleSetInboundUsersState handles the PUT /inbound/{tag}/users/state API request.
+// The body is the complete list of users the inbound should hold; only the difference is applied.
+func (s *APIServer) handleSetInboundUsersState() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := chi.URLParam(r, "tag")
+		if tag == "" {
+			RespondWithError(w, http.StatusBadRequest, "Inbound tag is required")
+			return
+		}
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+		var desired []SimplifiedUser
+		if err := json.NewDecoder(r.Body).Decode(&desired); err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		// A null body would otherwise read as an empty list and remove every user
+		if desired == nil {
+			RespondWithError(w, http.StatusBadRequest, "Request body must be a JSON array of users")
+			return
+		}
+
+		// Users are matched by email, so every desired user needs a distinct one
+		seen := make(map[string]struct{}, len(desired))
+		for _, user := range desired {
+			if user.Email == "" {
+				RespondWithError(w, http.StatusBadRequest, "Every user must have an email")
+				return
+			}
+			if _, ok := seen[user.Email]; ok {
+				RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Duplicate email %s", user.Email))
+				return
+			}
+			seen[user.Email] = struct{}{}
+		}
+
+		// The account type depends on the protocol of the inbound
+		protocolName, err := s.inboundProtocol(r.Context(), tag)
+		if err != nil {
+			RespondWithError(w, inboundProtocolErrorStatus(err), fmt.Sprintf("Failed to determine inbound protocol: %v", err))
+			return
+		}
+		for _, user := range desired {
+			if err := validateUser(protocolName, user); err != nil {
+				RespondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		resp, err := s.xrayClient.HandlerClient.GetInboundUsers(r.Context(), &proxyman_command.GetInboundUserRequest{Tag: tag})
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get inbound users: %v", err))
+			return
+		}
+
+		// Suspended users stay out of the inbound; their suspension puts them back when lifted
+		active := make([]SimplifiedUser, 0, len(desired))
+		var suspended []string
+		for _, user := range desired {
+			if s.store.Suspensions.IsSuspended(user.Email) {
+				suspended = append(suspended, user.Email)
+				continue
+			}
+			active = append(active, user)
+		}
+
+		toAdd, toRemove, toUpdate, unchanged := diffInboundUsers(resp.GetUsers(), active)
+		diff := InboundUsersDiff{
+			Suspended: suspended,
+			Added:     make([]string, 0, len(toAdd)),
+			Removed:   make([]string, 0, len(toRemove)),
+			Updated:   make([]string, 0, len(toUpdate)),
+			Unchanged: unchanged,
+			DryRun:    dryRun,
+		}
+
+		if dryRun {
+			for _, user := range toAdd {
+				diff.Added = append(diff.Added, user.Email)
+			}
+			diff.Removed = append(diff.Removed, toRemove...)
+			for _, user := range toUpdate {
+				diff.Updated = append(diff.Updated, user.Email)
+			}
+			RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: diff})
+			return
+		}
+
+		err = s.applyInboundUsersDiff(r.Context(), tag, protocolName, resp.GetUsers(), toAdd, toRemove, toUpdate, &diff)
+		s.forgetRemovedUsers(r.Context(), diff.Removed...)
+		if err != nil {
+			// Keep the store in line with what Xray-core now holds, and tell the client how far it got
+			RespondWithErrorData(w, http.StatusInternalServerError, err.Error(), diff)
+			return
+		}
+
+		// The desired list becomes the stored state of the inbound
+		s.replaceStoredUsers(tag, protocolName, desired...)
+		s.storeExpiries(r.Context(), desired...)
+		s.dropShortIDs(tag, diff.Removed...)
+		s.assignUserShortIDs(r.Context(), tag, active...)
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: diff})
+	}
+}
+
 // handleGetInboundUsers handles the GET /inbound/{tag}/users API request.
 func (s *APIServer) handleGetInboundUsers() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -293,23 +472,12 @@ func (s *APIServer) handleGetInboundUsers() http.HandlerFunc {
 			if user.Account != nil {
 				var accountDetails map[string]interface{}
 
-				// Try to decode the account into a map using the generic decoder first
+				// Accounts of known protocols are decoded by their protocol adapter
 				decodedAccount, err := DecodeTypedMessage(user.Account)
 				if err == nil {
 					if accMap, ok := decodedAccount.(map[string]interface{}); ok {
 						accountDetails = accMap
 					}
-				} else {
-					// If generic decoding fails, fall back to the specific VLESS account type
-					if instance, instanceErr := user.Account.GetInstance(); instanceErr == nil {
-						if account, ok := instance.(*vless.Account); ok {
-							// Manually create a map for the VLESS account
-							accountDetails = map[string]interface{}{
-								"id":   account.Id,
-								"flow": account.Flow,
-							}
-						}
-					}
 				}
 
 				// Merge the flattened account details into the main user object
@@ -369,6 +537,14 @@ func (s *APIServer) handleRemoveInbound() http.HandlerFunc {
 			return
 		}
 
+		// Note the users of the inbound, to forget those it was the last inbound of
+		var emails []string
+		if usersResp, err := s.xrayClient.HandlerClient.GetInboundUsers(r.Context(), &proxyman_command.GetInboundUserRequest{Tag: tag}); err == nil {
+			for _, user := range usersResp.GetUsers() {
+				emails = append(emails, user.Email)
+			}
+		}
+
 		req := &proxyman_command.RemoveInboundRequest{
 			Tag: tag,
 		}
@@ -384,6 +560,17 @@ func (s *APIServer) handleRemoveInbound() http.HandlerFunc {
 			return
 		}
 
+		unstoreObject(s.store.Inbounds, "inbound", tag)
+
+		// Users of a removed inbound can no longer be restored
+		if err := s.store.Users.DeleteTag(tag); err != nil {
+			log.Printf("Warning: failed to drop stored users of inbound %s: %v", tag, err)
+		}
+		if err := s.store.ShortIDs.DeleteTag(tag); err != nil {
+			log.Printf("Warning: failed to drop REALITY shortIds of inbound %s: %v", tag, err)
+		}
+		s.forgetRemovedUsers(r.Context(), emails...)
+
 		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("Inbound '%s' removed successfully", tag)})
 	}
 }
\ No newline at end of file
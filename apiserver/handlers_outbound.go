@@ -10,9 +10,15 @@ import (
 	"github.com/xtls/xray-core/infra/conf"
 )
 
-// handleListOutbounds handles the GET /outbound API request.
+// handleListOutbounds handles the GET /outbound?view=<raw> API request.
 func (s *APIServer) handleListOutbounds() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		view, err := parseConfigView(r.URL.Query().Get("view"))
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		req := &proxyman_command.ListOutboundsRequest{}
 
 		resp, err := s.xrayClient.HandlerClient.ListOutbounds(r.Context(), req)
@@ -21,27 +27,51 @@ func (s *APIServer) handleListOutbounds() http.HandlerFunc {
 			return
 		}
 
+		if view == configViewRaw {
+			var warnings []ItemWarning
+			rawOutbounds := make([]interface{}, 0, len(resp.GetOutbounds()))
+			for _, outbound := range resp.GetOutbounds() {
+				rawOutbound, err := rawProtoJSON(outbound)
+				if err != nil {
+					warnings = append(warnings, ItemWarning{Tag: outbound.Tag, Warning: fmt.Sprintf("Failed to encode outbound: %v", err)})
+					continue
+				}
+				rawOutbounds = append(rawOutbounds, rawOutbound)
+			}
+			RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: rawOutbounds, Warnings: warnings})
+			return
+		}
+
 		// Create a new slice for our simplified response
 		simplifiedOutbounds := make([]*conf.OutboundDetourConfig, 0, len(resp.GetOutbounds()))
 
+		// An outbound that cannot be reverse mapped is left out with a warning rather than failing the listing
+		var warnings []ItemWarning
 		for _, outbound := range resp.GetOutbounds() {
 			confOutbound, err := ReverseOutbound(outbound)
 			if err != nil {
-				RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reverse map outbound %s: %v", outbound.Tag, err))
-				return
+				warnings = append(warnings, ItemWarning{Tag: outbound.Tag, Warning: fmt.Sprintf("Failed to reverse map outbound: %v", err)})
+				continue
 			}
 			simplifiedOutbounds = append(simplifiedOutbounds, confOutbound)
 		}
 
-		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: simplifiedOutbounds})
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: simplifiedOutbounds, Warnings: warnings})
 	}
 }
 
 // handleAddOutbound handles the POST /outbound API request.
 func (s *APIServer) handleAddOutbound() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Keep the raw body around so the outbound can be restored exactly as submitted
+		var rawOutbound json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&rawOutbound); err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+
 		var outboundConfig conf.OutboundDetourConfig
-		if err := json.NewDecoder(r.Body).Decode(&outboundConfig); err != nil {
+		if err := json.Unmarshal(rawOutbound, &outboundConfig); err != nil {
 			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
 			return
 		}
@@ -62,6 +92,8 @@ func (s *APIServer) handleAddOutbound() http.HandlerFunc {
 			return
 		}
 
+		storeObject(s.store.Outbounds, "outbound", outboundConfig.Tag, rawOutbound)
+
 		RespondWithJSON(w, http.StatusCreated, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("Outbound '%s' added successfully", outboundConfig.Tag)})
 	}
 }
@@ -85,6 +117,8 @@ func (s *APIServer) handleRemoveOutbound() http.HandlerFunc {
 			return
 		}
 
+		unstoreObject(s.store.Outbounds, "outbound", tag)
+
 		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: "Outbound removed successfully"})
 	}
 }
@@ -22,27 +22,12 @@ func (s *APIServer) handleAddRoutingRule() http.HandlerFunc {
 			return
 		}
 
-		rule, err := conf.ParseRule(rawRule)
+		typedConfig, err := newRuleConfig(rawRule)
 		if err != nil {
 			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse routing rule: %v", err))
 			return
 		}
 
-		config := &router.Config{
-			Rule: []*router.RoutingRule{rule},
-		}
-
-		configBytes, err := proto.Marshal(config)
-		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to marshal routing config: %v", err))
-			return
-		}
-
-		typedConfig := &serial.TypedMessage{
-			Type:  "xray.app.router.Config",
-			Value: configBytes,
-		}
-
 		addReq := &router_command.AddRuleRequest{
 			Config: typedConfig,
 		}
@@ -53,6 +38,11 @@ func (s *APIServer) handleAddRoutingRule() http.HandlerFunc {
 			return
 		}
 
+		// Only tagged rules can be told apart, so only those are restored after Xray-core restarts
+		if ruleTag := ruleTagOf(rawRule); ruleTag != "" {
+			storeObject(s.store.Rules, "routing rule", ruleTag, rawRule)
+		}
+
 		RespondWithJSON(w, http.StatusCreated, JSONSuccessResponse{Success: true, Message: "Routing rule added successfully"})
 	}
 }
@@ -76,6 +66,8 @@ func (s *APIServer) handleRemoveRoutingRule() http.HandlerFunc {
 			return
 		}
 
+		unstoreObject(s.store.Rules, "routing rule", tag)
+
 		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: "Routing rule removed successfully"})
 	}
 }
@@ -279,12 +271,43 @@ func (s *APIServer) handleBlockIP() http.HandlerFunc {
 
 
 
+		storeObject(s.store.Rules, "routing rule", req.RuleTag, rawRule)
+
+
+
 		RespondWithJSON(w, http.StatusCreated, JSONSuccessResponse{Success: true, Message: "Routing rule for blocking IPs added successfully"})
 
 	}
 
 }
 
+// newRuleConfig parses a routing rule in Xray's JSON format and wraps it in the router config AddRule expects.
+func newRuleConfig(rawRule json.RawMessage) (*serial.TypedMessage, error) {
+	rule, err := conf.ParseRule(rawRule)
+	if err != nil {
+		return nil, err
+	}
 
+	configBytes, err := proto.Marshal(&router.Config{
+		Rule: []*router.RoutingRule{rule},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal routing config: %w", err)
+	}
 
+	return &serial.TypedMessage{
+		Type:  "xray.app.router.Config",
+		Value: configBytes,
+	}, nil
+}
 
+// ruleTagOf returns the ruleTag of a routing rule in Xray's JSON format, if any.
+func ruleTagOf(rawRule json.RawMessage) string {
+	var tagged struct {
+		RuleTag string `json:"ruleTag"`
+	}
+	if err := json.Unmarshal(rawRule, &tagged); err != nil {
+		return ""
+	}
+	return tagged.RuleTag
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	stats_command "github.com/xtls/xray-core/app/stats/command"
 )
@@ -37,11 +38,19 @@ func (s *APIServer) handleGetNamedStats() http.HandlerFunc {
 			Reset_: reset,
 		}
 
+		// A reset counter is credited to quotas first, so no usage is lost
+		if reset {
+			s.quotaMu.Lock()
+			defer s.quotaMu.Unlock()
+		}
 		resp, err := s.xrayClient.StatsClient.GetStats(r.Context(), req)
 		if err != nil {
 			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get named stat: %v", err))
 			return
 		}
+		if reset {
+			s.creditResetStats([]*stats_command.Stat{resp.GetStat()})
+		}
 
 		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp.Stat})
 	}
@@ -64,17 +73,26 @@ func (s *APIServer) handleQueryStats() http.HandlerFunc {
 			Reset_:  reset, // Use Reset_ as identified from example
 		}
 
+		// Reset counters are credited to quotas first, so no usage is lost
+		if reset {
+			s.quotaMu.Lock()
+			defer s.quotaMu.Unlock()
+		}
 		resp, err := s.xrayClient.StatsClient.QueryStats(r.Context(), req)
 		if err != nil {
 			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to query stats: %v", err))
 			return
 		}
+		if reset {
+			s.creditResetStats(resp.GetStat())
+		}
 
 		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp.Stat})
 	}
 }
 
 // handleGetStatsOnline handles the GET /stats/online?name=<name> API request.
+// The name is an email or a user>>>{email}>>>online name; the value is the number of online IPs.
 func (s *APIServer) handleGetStatsOnline() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		name := r.URL.Query().Get("name")
@@ -84,13 +102,12 @@ func (s *APIServer) handleGetStatsOnline() http.HandlerFunc {
 		}
 
 		req := &stats_command.GetStatsRequest{
-			Name:  name,
-			Reset_: false,
+			Name: onlineStatName(name),
 		}
 
-		resp, err := s.xrayClient.StatsClient.GetStats(r.Context(), req)
+		resp, err := s.xrayClient.StatsClient.GetStatsOnline(r.Context(), req)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get online stat: %v", err))
+			RespondWithError(w, onlineErrorStatus(err), fmt.Sprintf("Failed to get online stat: %v", err))
 			return
 		}
 
@@ -107,17 +124,83 @@ func (s *APIServer) handleGetStatsOnlineIpList() http.HandlerFunc {
 			return
 		}
 
-		req := &stats_command.GetStatsRequest{
-			Name:  name,
-			Reset_: false,
+		user, err := s.getOnlineUser(r.Context(), name)
+		if err != nil {
+			RespondWithError(w, onlineErrorStatus(err), fmt.Sprintf("Failed to get online IP list: %v", err))
+			return
 		}
 
-		resp, err := s.xrayClient.StatsClient.GetStats(r.Context(), req)
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: user})
+	}
+}
+
+// handleGetOnlineUsers handles the GET /stats/online/users API request.
+func (s *APIServer) handleGetOnlineUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := s.listOnlineUsers(r.Context())
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get online IP list: %v", err))
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get online users: %v", err))
 			return
 		}
 
-		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp.Stat})
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: users})
+	}
+}
+
+// handleGetStatsHistory handles the GET /stats/history?name=<name>&from=<time>&to=<time>&step=<duration> API request.
+func (s *APIServer) handleGetStatsHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			RespondWithError(w, http.StatusBadRequest, "Stat name is required")
+			return
+		}
+
+		now := time.Now()
+		to, err := parseTimeParam(r.URL.Query().Get("to"), now)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		from, err := parseTimeParam(r.URL.Query().Get("from"), to.Add(-24*time.Hour))
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !from.Before(to) {
+			RespondWithError(w, http.StatusBadRequest, "from must be before to")
+			return
+		}
+
+		step := time.Hour
+		if v := r.URL.Query().Get("step"); v != "" {
+			if step, err = time.ParseDuration(v); err != nil {
+				RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid step: %v", err))
+				return
+			}
+		}
+		if step > 0 && to.Sub(from)/step > maxHistoryPoints {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Too many points requested, at most %d are allowed", maxHistoryPoints))
+			return
+		}
+
+		points, err := s.store.History.Query(name, from, to, step)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to query history: %v", err))
+			return
+		}
+
+		resp := StatsHistoryResponse{
+			Name:   name,
+			Step:   step.String(),
+			From:   from,
+			To:     to,
+			Points: points,
+		}
+		for _, point := range points {
+			resp.Total += point.Value
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp})
 	}
 }
@@ -2,12 +2,20 @@ package apiserver
 
 import (
 	"net/http"
+	"time"
 )
 
-// HandleStatus returns a simple success message.
+// HandleStatus returns a simple success message, along with when Xray-core was last seen restarting.
 func (s *APIServer) HandleStatus(w http.ResponseWriter, r *http.Request) {
-	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+	payload := map[string]interface{}{
 		"success": true,
 		"message": "Xray API Bridge is running!",
-	})
+	}
+
+	if lastRestart := s.xrayClient.LastRestart(); !lastRestart.IsZero() {
+		payload["last_core_restart"] = lastRestart.Format(time.RFC3339)
+		payload["since_last_core_restart"] = time.Since(lastRestart).Round(time.Second).String()
+	}
+
+	RespondWithJSON(w, http.StatusOK, payload)
 }
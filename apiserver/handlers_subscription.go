@@ -1,35 +1,98 @@
 package apiserver
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
-	"net/url"
-	"os"
 	"strings"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/xtls/xray-core/app/proxyman/command"
 	"github.com/xtls/xray-core/infra/conf"
-	jsonconf "github.com/xtls/xray-core/infra/conf/json"
 )
 
-// HandleSubscription generates subscription links based on the bridge's configuration.
+// subscriptionQuery selects the users a subscription is generated for.
+type subscriptionQuery struct {
+	all    bool                // every user, for admin requests
+	ids    map[string]struct{} // user IDs, or passwords for trojan and shadowsocks
+	emails map[string]struct{} // users resolved from a subscription token
+}
+
+// matches reports whether the query selects a client with the given credentials.
+func (q subscriptionQuery) matches(id, password, email string) bool {
+	if q.all {
+		return true
+	}
+	if _, ok := q.ids[id]; ok && id != "" {
+		return true
+	}
+	if _, ok := q.ids[password]; ok && password != "" {
+		return true
+	}
+	_, ok := q.emails[email]
+	return ok && email != ""
+}
+
+// HandleSubscription generates subscription links for the users whose IDs or passwords are
+// given in the 'uuid' query parameter. Requests carrying the admin key may leave it out to
+// get the subscription of every user; passing the admin key as the 'uuid' still works but is
+// deprecated.
 func (s *APIServer) HandleSubscription(w http.ResponseWriter, r *http.Request) {
+	var query subscriptionQuery
+	// (#B1) Mandate 'uuid' query parameter
+	uuidQuery := r.URL.Query().Get("uuid")
+	switch {
+	case s.adminKey != "" && subtle.ConstantTimeCompare([]byte(uuidQuery), []byte(s.adminKey)) == 1:
+		// Deprecated: the admin key used to be passed as the 'uuid', exposing it in the URL
+		log.Printf("Warning: subscription requested with the admin key as 'uuid', which is deprecated; send it in the Authorization header instead")
+		w.Header().Set("Deprecation", "true")
+		query.all = true
+	case uuidQuery != "":
+		query.ids = make(map[string]struct{})
+		for _, id := range strings.Split(uuidQuery, ",") {
+			query.ids[strings.TrimSpace(id)] = struct{}{}
+		}
+	case s.isAdminRequest(r):
+		query.all = true
+	default:
+		RespondWithError(w, http.StatusBadRequest, "Missing required 'uuid' query parameter.")
+		return
+	}
+
+	s.serveSubscription(w, r, query)
+}
+
+// HandleSubscriptionToken generates subscription links for the user a subscription token was
+// issued to, so that the user's credentials never show up in the subscription URL.
+func (s *APIServer) HandleSubscriptionToken(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.store.SubscriptionTokens.Lookup(chi.URLParam(r, "token"))
+	if !ok {
+		RespondWithError(w, http.StatusNotFound, "Unknown subscription token.")
+		return
+	}
+
+	s.serveSubscription(w, r, subscriptionQuery{emails: map[string]struct{}{t.Email: {}}})
+}
+
+// serveSubscription writes the subscription of the users selected by query, in the format
+// requested by the 'format' query parameter.
+func (s *APIServer) serveSubscription(w http.ResponseWriter, r *http.Request, query subscriptionQuery) {
 	// Check for mandatory gRPC client
 	if s.xrayClient == nil || s.xrayClient.HandlerClient == nil {
 		RespondWithError(w, http.StatusInternalServerError, "Xray gRPC client is not available. This feature requires a running Xray-core instance.")
 		return
 	}
 
-	// (#B1) Mandate 'uuid' query parameter
-	uuidQuery := r.URL.Query().Get("uuid")
-	if uuidQuery == "" {
-		RespondWithError(w, http.StatusBadRequest, "Missing required 'uuid' query parameter.")
+	format := r.URL.Query().Get("format")
+	if !isSubscriptionFormat(format) {
+		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported subscription format '%s', expected one of: %s", format, strings.Join(subscriptionFormats, ", ")))
 		return
 	}
 
 	// Load subscription profiles from the specified file
-	subscriptionProfiles, err := loadSubscriptionProfiles(s.subsConfigPath)
+	subscriptionProfiles, err := s.subsProfiles.Valid()
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load subscription config: %v", err))
 		return
@@ -57,37 +120,57 @@ func (s *APIServer) HandleSubscription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// --- Link Generation ---
-	links, err := s.generateSubscriptionLinks(inbounds, subscriptionProfiles, uuidQuery)
+	// --- Node Generation ---
+	nodes, emails, err := s.generateSubscriptionNodes(inbounds, subscriptionProfiles, query)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to generate subscription links: %v", err))
 		return
 	}
 
-	if len(links) == 0 {
+	if len(nodes) == 0 {
 		// (#A2) If no links are generated, it might be because no matching protocols were found.
-		RespondWithError(w, http.StatusNotFound, "No matching subscription links could be generated. Ensure the Xray-core instance is configured as a server with 'vless' or 'vmess' inbounds, and the provided 'uuid' is correct.")
+		RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No matching subscription links could be generated. Ensure the Xray-core instance is configured as a server with %s inbounds, and the requested users exist.", strings.Join(subscriptionProtocols(), ", ")))
 		return
 	}
 
 	// --- Response ---
-	RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: links})
+	s.setSubscriptionHeaders(w, r, emails)
+	s.writeSubscription(w, format, nodes)
 }
 
-// generateSubscriptionLinks creates share links from a slice of user-friendly InboundDetourConfig.
-func (s *APIServer) generateSubscriptionLinks(inbounds []conf.InboundDetourConfig, profiles []SubscriptionProfile, uuidQuery string) ([]string, error) {
-	type clientInfo struct {
-		ID    string `json:"id"`
-		Email string `json:"email"`
-		Flow  string `json:"flow"`
-		Level int64  `json:"level"`
+// generateSubscriptionNodes resolves every subscription profile against the inbounds for each
+// matched client. It also returns the emails of the matched clients.
+func (s *APIServer) generateSubscriptionNodes(inbounds []conf.InboundDetourConfig, profiles []SubscriptionProfile, query subscriptionQuery) ([]subscriptionNode, []string, error) {
+	// sameClient reports whether two clients, possibly of different inbounds, are the same user.
+	sameClient := func(a, b subscriptionClient) bool {
+		switch {
+		case a.Email != "" && b.Email != "":
+			return a.Email == b.Email
+		case a.ID != "" || b.ID != "":
+			return a.ID == b.ID
+		default:
+			return a.Password == b.Password
+		}
+	}
+	// clientKey identifies a user across inbounds.
+	clientKey := func(c subscriptionClient) string {
+		switch {
+		case c.Email != "":
+			return "email:" + c.Email
+		case c.ID != "":
+			return "id:" + c.ID
+		default:
+			return "password:" + c.Password
+		}
 	}
 
-	// 1. Segregate all clients by protocol and network
-	categorizedClients := make(map[string][]clientInfo)
+	// 1. Segregate all clients by protocol and network, and by inbound tag
+	categorizedClients := make(map[string][]subscriptionClient)
+	clientsByTag := make(map[string][]subscriptionClient)
 	foundSpecialProtocol := false
 	for _, inbound := range inbounds {
-		if inbound.Protocol != "vless" && inbound.Protocol != "vmess" {
+		adapter, ok := subscriptionAdapterOf(inbound.Protocol)
+		if !ok {
 			continue
 		}
 		foundSpecialProtocol = true
@@ -102,42 +185,30 @@ func (s *APIServer) generateSubscriptionLinks(inbounds []conf.InboundDetourConfi
 
 		key := inbound.Protocol + "_" + inbNetwork
 
-		var clients []clientInfo
+		var clients []subscriptionClient
 		if inbound.Settings != nil {
-			var settings struct {
-				Clients json.RawMessage `json:"clients"`
-			}
-			if err := json.Unmarshal(*inbound.Settings, &settings); err == nil {
-				json.Unmarshal(settings.Clients, &clients)
+			var err error
+			if clients, err = adapter.SubscriptionClients(*inbound.Settings); err != nil {
+				log.Printf("Warning: failed to read the clients of inbound %s: %v", inbound.Tag, err)
 			}
 		}
 		if len(clients) > 0 {
 			categorizedClients[key] = append(categorizedClients[key], clients...)
+			clientsByTag[inbound.Tag] = clients
 		}
 	}
 
 	if !foundSpecialProtocol {
-		return nil, fmt.Errorf("subscription feature is only available on server-side configurations with 'vless' or 'vmess' inbounds")
-	}
-
-	// 2. (#B2, #B3) Filter clients based on uuidQuery
-	superKey := os.Getenv("XRAY_API_BRIDGE_SUBS_SUPERKEY")
-	useAllClients := (superKey != "" && uuidQuery == superKey)
-
-	var targetIDs map[string]struct{}
-	if !useAllClients {
-		targetIDs = make(map[string]struct{})
-		for _, id := range strings.Split(uuidQuery, ",") {
-			targetIDs[strings.TrimSpace(id)] = struct{}{}
-		}
+		return nil, nil, fmt.Errorf("subscription feature is only available on server-side configurations with %s inbounds", strings.Join(subscriptionProtocols(), ", "))
 	}
 
+	// 2. (#B2, #B3) Filter clients based on the query
 	// This map will hold all clients that match the query, categorized by their protocol+network key.
-	filteredClients := make(map[string][]clientInfo)
+	filteredClients := make(map[string][]subscriptionClient)
 	// This list preserves the original order of matched clients, which is crucial for device-based ordering.
-	var orderedMatchedClients []clientInfo
+	var orderedMatchedClients []subscriptionClient
 
-	// To avoid duplicates in orderedMatchedClients when a user ID appears in multiple inbounds
+	// To avoid duplicates in orderedMatchedClients when a user appears in multiple inbounds
 	seenClients := make(map[string]bool)
 
 	// Find the maximum number of clients in any category to determine the loop count
@@ -153,46 +224,106 @@ func (s *APIServer) generateSubscriptionLinks(inbounds []conf.InboundDetourConfi
 		for key, clientList := range categorizedClients {
 			if i < len(clientList) {
 				client := clientList[i]
-				match := useAllClients
-				if !match {
-					_, match = targetIDs[client.ID]
-				}
+				match := query.matches(client.ID, client.Password, client.Email)
 
 				if match {
 					if _, exists := filteredClients[key]; !exists {
-						filteredClients[key] = []clientInfo{}
+						filteredClients[key] = []subscriptionClient{}
 					}
 					filteredClients[key] = append(filteredClients[key], client)
 
-					if !seenClients[client.ID] {
+					if !seenClients[clientKey(client)] {
 						orderedMatchedClients = append(orderedMatchedClients, client)
-						seenClients[client.ID] = true
+						seenClients[clientKey(client)] = true
 					}
 				}
 			}
 		}
 	}
 
-	// 3. Generate links
-	var generatedLinks []string
-	getRealityShortID := func(clientIndex int) string {
-		for _, ib := range inbounds {
-			if ib.Protocol == "vless" && ib.StreamSetting != nil && ib.StreamSetting.Security == "reality" && ib.StreamSetting.REALITYSettings != nil {
-				shortIDs := ib.StreamSetting.REALITYSettings.ShortIds
-				if len(shortIDs) > 0 {
-					if clientIndex < len(shortIDs) {
-						return shortIDs[clientIndex]
-					}
-					return shortIDs[len(shortIDs)-1] // Fallback to the last one
+	// 3. Resolve the inbound of every profile: the one named by its inboundTag, or else the
+	// first inbound of its protocol and network
+	inboundNetwork := func(ib *conf.InboundDetourConfig) string {
+		ibNet := "tcp"
+		if ib.StreamSetting != nil && ib.StreamSetting.Network != nil {
+			ibNet = string(*ib.StreamSetting.Network)
+		}
+		if ibNet == "tcp" {
+			ibNet = "raw"
+		}
+		return ibNet
+	}
+	profileInbounds := make([]*conf.InboundDetourConfig, len(profiles))
+	for subIndex, sub := range profiles {
+		subNetwork := sub.Network
+		if subNetwork == "tcp" {
+			subNetwork = "raw"
+		}
+		for i := range inbounds {
+			ib := &inbounds[i]
+			if sub.InboundTag != "" {
+				if ib.Tag == sub.InboundTag {
+					profileInbounds[subIndex] = ib
+					break
 				}
+			} else if ib.Protocol == sub.Protocol && inboundNetwork(ib) == subNetwork {
+				profileInbounds[subIndex] = ib
+				break
 			}
 		}
-		return ""
+		if sub.InboundTag == "" {
+			continue
+		}
+		switch ib := profileInbounds[subIndex]; {
+		case ib == nil:
+			log.Printf("Warning: inbound '%s' of subscription profile %d not found. Skipping.", sub.InboundTag, subIndex)
+		case ib.Protocol != sub.Protocol || inboundNetwork(ib) != subNetwork:
+			log.Printf("Warning: inbound '%s' of subscription profile %d is %s over %s, not %s over %s. Skipping.", sub.InboundTag, subIndex, ib.Protocol, inboundNetwork(ib), sub.Protocol, subNetwork)
+			profileInbounds[subIndex] = nil
+		}
+	}
+
+	// 4. Generate nodes
+	var generatedNodes []subscriptionNode
+	// getRealityShortID takes the short IDs of the profile's inbound, or of the first VLESS REALITY
+	// inbound when it has none (e.g. for the REALITY downloadSettings of an xhttp TLS profile).
+	// Users keep the shortId assigned to them on that inbound when they were added; others get
+	// the one at their position among the matched clients.
+	getRealityShortID := func(inbound *conf.InboundDetourConfig, client subscriptionClient, clientIndex int) string {
+		hasReality := func(ib *conf.InboundDetourConfig) bool {
+			return ib.StreamSetting != nil && ib.StreamSetting.Security == "reality" && ib.StreamSetting.REALITYSettings != nil && len(ib.StreamSetting.REALITYSettings.ShortIds) > 0
+		}
+		if inbound == nil || !hasReality(inbound) {
+			inbound = nil
+			for i := range inbounds {
+				if inbounds[i].Protocol == "vless" && hasReality(&inbounds[i]) {
+					inbound = &inbounds[i]
+					break
+				}
+			}
+		}
+		if inbound == nil {
+			return ""
+		}
+		shortIDs := inbound.StreamSetting.REALITYSettings.ShortIds
+		if sid, ok := s.storedShortID(inbound.Tag, client.Email, shortIDs); ok {
+			return sid
+		}
+		if clientIndex < len(shortIDs) {
+			return shortIDs[clientIndex]
+		}
+		return shortIDs[len(shortIDs)-1] // Fallback to the last one
+	}
+	getSpiderX := func(sid string, subIndex int) string {
+		if len(sid) >= 8 {
+			return "get-" + sid[len(sid)-8:]
+		}
+		return fmt.Sprintf("get-sub%05d", subIndex)
 	}
 
 	// Outer loop: Iterate through the matched clients in their original order (device order)
 	for clientIndex, client := range orderedMatchedClients {
-		// Inner loop: Iterate through subscription profiles to generate all links for this client
+		// Inner loop: Iterate through subscription profiles to generate all nodes for this client
 		for subIndex, sub := range profiles {
 			subNetwork := sub.Network
 			if subNetwork == "tcp" {
@@ -200,81 +331,67 @@ func (s *APIServer) generateSubscriptionLinks(inbounds []conf.InboundDetourConfi
 			}
 			key := sub.Protocol + "_" + subNetwork
 
-			// Check if this client exists for the profile's protocol/network type
-			clientExistsForProfile := false
-			for _, c := range categorizedClients[key] {
-				if c.ID == client.ID {
-					clientExistsForProfile = true
+			// Find this user among the clients of the profile's protocol/network type, or of its
+			// inbound when pinned to one, whose credentials are used for the node
+			originalInbound := profileInbounds[subIndex]
+			candidates := categorizedClients[key]
+			if sub.InboundTag != "" {
+				if originalInbound == nil {
+					continue
+				}
+				candidates = clientsByTag[sub.InboundTag]
+			}
+			var profileClient *subscriptionClient
+			for i, c := range candidates {
+				if sameClient(c, client) {
+					profileClient = &candidates[i]
 					break
 				}
 			}
-			if !clientExistsForProfile {
+			if profileClient == nil {
 				continue
 			}
 
-			if sub.Level != -1 && client.Level < sub.Level {
+			if sub.Level != -1 && profileClient.Level < sub.Level {
 				continue
 			}
 
-			// --- Start of link generation logic ---
-			port := sub.Port
-			if port == 0 {
-				port = 443
+			// --- Start of node generation logic ---
+			node := subscriptionNode{
+				Protocol:   sub.Protocol,
+				Address:    sub.Address,
+				Port:       sub.Port,
+				ID:         profileClient.ID,
+				Password:   profileClient.Password,
+				Method:     profileClient.Method,
+				Encryption: sub.Encryption,
+				Network:    subNetwork,
+				Security:   sub.Security,
+				LinkStyle:  sub.LinkStyle,
 			}
-
-			baseURL := fmt.Sprintf("%s://%s@%s:%d", sub.Protocol, client.ID, sub.Address, port)
-			queryParams := url.Values{}
-
-			if subNetwork != "raw" {
-				queryParams.Add("type", subNetwork)
+			if profileClient.ServerKey != "" {
+				node.Password = profileClient.ServerKey + ":" + profileClient.Password
 			}
-
-			if sub.Encryption != "" {
-				if sub.Protocol == "vless" && sub.Encryption != "none" {
-					queryParams.Add("encryption", url.QueryEscape(sub.Encryption))
-				} else if sub.Protocol == "vmess" && sub.Encryption != "auto" {
-					queryParams.Add("encryption", sub.Encryption)
-				}
+			if node.Port == 0 {
+				node.Port = 443
 			}
-
-			security := sub.Security
-			if security != "" && security != "none" {
-				queryParams.Add("security", security)
-			} else {
-				security = "none"
-			}
-
-			var originalInbound *conf.InboundDetourConfig
-			for i := range inbounds {
-				ib := &inbounds[i]
-				ibNet := "tcp"
-				if ib.StreamSetting != nil && ib.StreamSetting.Network != nil {
-					ibNet = string(*ib.StreamSetting.Network)
-				}
-				if ibNet == "tcp" {
-					ibNet = "raw"
-				}
-				if ib.Protocol == sub.Protocol && ibNet == subNetwork {
-					originalInbound = ib
-					break
-				}
+			if node.Security == "" {
+				node.Security = "none"
 			}
 
 			switch subNetwork {
 			case "xhttp":
-				if sub.Host != "" {
-					queryParams.Add("host", url.QueryEscape(sub.Host))
-				} else if sub.Network == "http" || sub.Network == "xhttp" || sub.Network == "ws" || sub.Network == "httpupgrade" {
-					queryParams.Add("host", url.QueryEscape(sub.Address))
+				node.Host = sub.Host
+				if node.Host == "" {
+					node.Host = sub.Address
 				}
 				if originalInbound != nil && originalInbound.StreamSetting != nil && originalInbound.StreamSetting.XHTTPSettings != nil {
-					queryParams.Add("path", url.QueryEscape(originalInbound.StreamSetting.XHTTPSettings.Path))
+					node.Path = originalInbound.StreamSetting.XHTTPSettings.Path
 				}
-				mode := sub.Mode
-				if mode == "" {
-					mode = "auto"
+				node.Mode = sub.Mode
+				if node.Mode == "" {
+					node.Mode = "auto"
 				}
-				queryParams.Add("mode", mode)
 
 				if len(sub.Extra) > 2 { // not empty {}
 					extraConfig := make(map[string]interface{})
@@ -283,56 +400,43 @@ func (s *APIServer) generateSubscriptionLinks(inbounds []conf.InboundDetourConfi
 							if sec, ok := ds["security"].(string); ok && sec == "reality" {
 								if rs, ok := ds["realitySettings"].(map[string]interface{}); ok {
 									if _, ok := rs["shortId"]; !ok {
-										sid := getRealityShortID(clientIndex)
+										sid := getRealityShortID(originalInbound, client, clientIndex)
 										if sid != "" {
 											rs["shortId"] = sid
 										}
 									}
 									if _, ok := rs["spiderX"]; !ok {
 										sid, _ := rs["shortId"].(string)
-										spx := ""
-										if len(sid) >= 8 {
-											spx = "get-" + sid[len(sid)-8:]
-										} else {
-											spx = fmt.Sprintf("get-sub%05d", subIndex)
-										}
-										rs["spiderX"] = spx
+										rs["spiderX"] = getSpiderX(sid, subIndex)
 									}
 								}
 							}
 						}
-						extraBytes, _ := json.Marshal(extraConfig)
-						queryParams.Add("extra", url.QueryEscape(string(extraBytes)))
+						node.Extra = extraConfig
 					}
 				}
 
 			case "http", "ws", "httpupgrade":
-				if sub.Host != "" {
-					host := sub.Host
-					if subNetwork == "http" {
-						host = strings.ReplaceAll(host, " ", "")
-					}
-					queryParams.Add("host", url.QueryEscape(host))
-				} else {
-					queryParams.Add("host", url.QueryEscape(sub.Address))
+				node.Host = sub.Host
+				if subNetwork == "http" {
+					node.Host = strings.ReplaceAll(node.Host, " ", "")
 				}
-				if sub.Path != "" && sub.Path != "/" {
-					queryParams.Add("path", url.QueryEscape(sub.Path))
+				if node.Host == "" {
+					node.Host = sub.Address
 				}
+				node.Path = sub.Path
 			case "grpc":
 				if originalInbound != nil && originalInbound.StreamSetting != nil && originalInbound.StreamSetting.GRPCSettings != nil {
 					grpcSettings := originalInbound.StreamSetting.GRPCSettings
-					serviceName := grpcSettings.ServiceName
-					if strings.Contains(serviceName, "|") {
-						serviceName = strings.Split(serviceName, "|")[0]
+					node.ServiceName = grpcSettings.ServiceName
+					if strings.Contains(node.ServiceName, "|") {
+						node.ServiceName = strings.Split(node.ServiceName, "|")[0]
 					}
-					queryParams.Add("serviceName", url.QueryEscape(serviceName))
 
-					mode := sub.Mode
-					if mode == "" {
-						mode = "gun"
+					node.Mode = sub.Mode
+					if node.Mode == "" {
+						node.Mode = "gun"
 					}
-					queryParams.Add("mode", mode)
 				}
 			case "kcp":
 				if originalInbound != nil && originalInbound.StreamSetting != nil && originalInbound.StreamSetting.KCPSettings != nil {
@@ -340,84 +444,43 @@ func (s *APIServer) generateSubscriptionLinks(inbounds []conf.InboundDetourConfi
 					if kcpSettings.HeaderConfig != nil {
 						var header struct{ Type string `json:"type"` }
 						if json.Unmarshal(kcpSettings.HeaderConfig, &header) == nil && header.Type != "none" {
-							queryParams.Add("headerType", header.Type)
+							node.HeaderType = header.Type
 						}
 					}
 					if kcpSettings.Seed != nil {
-						queryParams.Add("seed", url.QueryEscape(*kcpSettings.Seed))
+						node.Seed = *kcpSettings.Seed
 					}
 				}
 			}
 
-			switch security {
+			switch node.Security {
 			case "tls":
-				fp := sub.Fingerprint
-				if fp != "" {
-					queryParams.Add("fp", fp)
-				}
-
-				if sub.ServerName != "" {
-					queryParams.Add("sni", sub.ServerName)
-				}
-
-				if len(sub.Alpn) > 0 {
-					queryParams.Add("alpn", url.QueryEscape(strings.Join(sub.Alpn, ",")))
-				}
-				if sub.EchConfigList != "" {
-					queryParams.Add("ech", url.QueryEscape(sub.EchConfigList))
-				}
+				node.Fingerprint = sub.Fingerprint
+				node.ServerName = sub.ServerName
+				node.Alpn = sub.Alpn
+				node.EchConfigList = sub.EchConfigList
 			case "reality":
-				fp := sub.Fingerprint
-				if fp == "" {
-					fp = "chrome"
+				node.Fingerprint = sub.Fingerprint
+				if node.Fingerprint == "" {
+					node.Fingerprint = "chrome"
 				}
-				queryParams.Add("fp", fp)
+				node.ServerName = sub.ServerName
 
-				if sub.ServerName != "" {
-					queryParams.Add("sni", sub.ServerName)
-				}
-
-				flow := client.Flow
+				// The profile's flow takes precedence over the one defined on the server
+				node.Flow = profileClient.Flow
 				if sub.Flow != "" {
-					flow = sub.Flow
-				} else if flow == "" {
-					// If sub.Flow is empty and client.Flow is empty, do not add the flow parameter.
-				} else {
-					queryParams.Add("flow", flow)
-				}
-
-				if sub.Password == "" {
-					fmt.Printf("Warning: 'password' (pbk) is missing for a REALITY subscription profile (Address: %s). Skipping.\n", sub.Address)
-					continue
-				}
-				queryParams.Add("pbk", sub.Password)
-
-				if sub.Mldsa65Verify != "" {
-					queryParams.Add("pqv", url.QueryEscape(sub.Mldsa65Verify))
-				}
-
-				sid := getRealityShortID(clientIndex)
-				if sid != "" {
-					queryParams.Add("sid", sid)
+					node.Flow = sub.Flow
 				}
 
-				spx := ""
-				if len(sid) >= 8 {
-					spx = "get-" + sid[len(sid)-8:]
-				} else {
-					spx = fmt.Sprintf("get-sub%05d", subIndex)
-				}
-				queryParams.Add("spx", url.QueryEscape(spx))
-			}
-
-			finalURL := baseURL
-			if encodedQuery := queryParams.Encode(); encodedQuery != "" {
-				finalURL += "?" + encodedQuery
+				node.PublicKey = sub.Password
+				node.Mldsa65Verify = sub.Mldsa65Verify
+				node.ShortID = getRealityShortID(originalInbound, client, clientIndex)
+				node.SpiderX = getSpiderX(node.ShortID, subIndex)
 			}
 
-			desp := sub.Description
-			if desp == "" {
-				desp = fmt.Sprintf("%s_%s_%s", sub.Protocol, subNetwork, security)
+			node.Name = sub.Description
+			if node.Name == "" {
+				node.Name = fmt.Sprintf("%s_%s_%s", sub.Protocol, subNetwork, node.Security)
 				if subNetwork == "xhttp" && len(sub.Extra) > 2 { // not empty {}
 					var extraConfig struct {
 						DownloadSettings struct {
@@ -425,40 +488,23 @@ func (s *APIServer) generateSubscriptionLinks(inbounds []conf.InboundDetourConfi
 						} `json:"downloadSettings"`
 					}
 					if json.Unmarshal(sub.Extra, &extraConfig) == nil {
-						if dsSec := extraConfig.DownloadSettings.Security; dsSec != "" && security != dsSec {
-							desp = fmt.Sprintf("%s2%s", desp, dsSec)
+						if dsSec := extraConfig.DownloadSettings.Security; dsSec != "" && node.Security != dsSec {
+							node.Name = fmt.Sprintf("%s2%s", node.Name, dsSec)
 						}
 					}
 				}
 			}
-			finalURL += "#" + url.QueryEscape(desp)
 
-			generatedLinks = append(generatedLinks, finalURL)
+			generatedNodes = append(generatedNodes, node)
 		}
 	}
 
-	return generatedLinks, nil
-}
-
-// loadSubscriptionProfiles loads the subscription profiles from a JSONC file.
-func loadSubscriptionProfiles(path string) ([]SubscriptionProfile, error) {
-	if path == "" {
-		return nil, fmt.Errorf("subscription config path is not provided (XRAY_API_BRIDGE_SUBS_CONFIG)")
-	}
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("could not open subscription config file %s: %w", path, err)
-	}
-	defer file.Close()
-
-	// Use a JSONC-compatible reader
-	jsoncReader := &jsonconf.Reader{Reader: file}
-
-	var profiles []SubscriptionProfile
-	decoder := json.NewDecoder(jsoncReader)
-	if err := decoder.Decode(&profiles); err != nil {
-		return nil, fmt.Errorf("could not decode subscription config file %s: %w", path, err)
+	emails := make([]string, 0, len(orderedMatchedClients))
+	for _, client := range orderedMatchedClients {
+		if client.Email != "" {
+			emails = append(emails, client.Email)
+		}
 	}
 
-	return profiles, nil
-}
\ No newline at end of file
+	return generatedNodes, emails, nil
+}
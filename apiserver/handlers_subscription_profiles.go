@@ -0,0 +1,190 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// profileNotFoundError is returned by profile updates for an index out of range.
+type profileNotFoundError int
+
+func (e profileNotFoundError) Error() string {
+	return fmt.Sprintf("No subscription profile at index %d", int(e))
+}
+
+// parseProfileIndex reads the {index} URL parameter.
+func parseProfileIndex(r *http.Request) (int, error) {
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("Invalid profile index '%s'", chi.URLParam(r, "index"))
+	}
+	return index, nil
+}
+
+// decodeSubscriptionProfile decodes and validates a profile from a request body.
+func decodeSubscriptionProfile(r *http.Request) (SubscriptionProfile, error) {
+	var profile SubscriptionProfile
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profile); err != nil {
+		return SubscriptionProfile{}, fmt.Errorf("Invalid request body: %v", err)
+	}
+	if err := validateSubscriptionProfile(profile); err != nil {
+		return SubscriptionProfile{}, fmt.Errorf("Invalid subscription profile: %v", err)
+	}
+	return profile, nil
+}
+
+// respondWithProfileUpdateError maps the error of a profile update to a response.
+func respondWithProfileUpdateError(w http.ResponseWriter, err error) {
+	switch err := err.(type) {
+	case profileNotFoundError:
+		RespondWithError(w, http.StatusNotFound, err.Error())
+	case profilesChangedError:
+		w.Header().Set("ETag", string(err))
+		RespondWithError(w, http.StatusPreconditionFailed, err.Error())
+	default:
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update subscription profiles: %v", err))
+	}
+}
+
+// newSubscriptionProfileResponse pairs a profile with its index and, for a profile loaded from
+// the file, the reason it fails validation.
+func newSubscriptionProfileResponse(index int, profile SubscriptionProfile) SubscriptionProfileResponse {
+	resp := SubscriptionProfileResponse{Index: index, SubscriptionProfile: profile}
+	if err := validateSubscriptionProfile(profile); err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+func newSubscriptionProfileResponses(profiles []SubscriptionProfile) []SubscriptionProfileResponse {
+	resp := make([]SubscriptionProfileResponse, 0, len(profiles))
+	for i, profile := range profiles {
+		resp = append(resp, newSubscriptionProfileResponse(i, profile))
+	}
+	return resp
+}
+
+// handleListSubscriptionProfiles handles the GET /subscription/profiles API request.
+// The ETag header identifies the list, for the If-Match header of later changes.
+func (s *APIServer) handleListSubscriptionProfiles() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profiles, etag, err := s.subsProfiles.List()
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load subscription config: %v", err))
+			return
+		}
+		w.Header().Set("ETag", etag)
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newSubscriptionProfileResponses(profiles)})
+	}
+}
+
+// handleGetSubscriptionProfile handles the GET /subscription/profiles/{index} API request.
+func (s *APIServer) handleGetSubscriptionProfile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, err := parseProfileIndex(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		profiles, etag, err := s.subsProfiles.List()
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load subscription config: %v", err))
+			return
+		}
+		if index >= len(profiles) {
+			RespondWithError(w, http.StatusNotFound, profileNotFoundError(index).Error())
+			return
+		}
+		w.Header().Set("ETag", etag)
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newSubscriptionProfileResponse(index, profiles[index])})
+	}
+}
+
+// handleAddSubscriptionProfile handles the POST /subscription/profiles API request.
+// The profile is appended after the existing ones.
+func (s *APIServer) handleAddSubscriptionProfile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profile, err := decodeSubscriptionProfile(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		profiles, etag, err := s.subsProfiles.Update(r.Header.Get("If-Match"), func(profiles []SubscriptionProfile) ([]SubscriptionProfile, error) {
+			return append(profiles, profile), nil
+		})
+		if err != nil {
+			respondWithProfileUpdateError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag)
+
+		index := len(profiles) - 1
+		RespondWithJSON(w, http.StatusCreated, JSONSuccessResponse{Success: true, Data: SubscriptionProfileResponse{Index: index, SubscriptionProfile: profile}, Message: fmt.Sprintf("Subscription profile %d added", index)})
+	}
+}
+
+// handleUpdateSubscriptionProfile handles the PUT /subscription/profiles/{index} API request.
+// With an If-Match header, the profiles must not have changed since the index was read.
+func (s *APIServer) handleUpdateSubscriptionProfile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, err := parseProfileIndex(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		profile, err := decodeSubscriptionProfile(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		_, etag, err := s.subsProfiles.Update(r.Header.Get("If-Match"), func(profiles []SubscriptionProfile) ([]SubscriptionProfile, error) {
+			if index >= len(profiles) {
+				return nil, profileNotFoundError(index)
+			}
+			profiles[index] = profile
+			return profiles, nil
+		})
+		if err != nil {
+			respondWithProfileUpdateError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag)
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: SubscriptionProfileResponse{Index: index, SubscriptionProfile: profile}, Message: fmt.Sprintf("Subscription profile %d updated", index)})
+	}
+}
+
+// handleRemoveSubscriptionProfile handles the DELETE /subscription/profiles/{index} API request.
+// The profiles after it move up by one. With an If-Match header, the profiles must not have
+// changed since the index was read.
+func (s *APIServer) handleRemoveSubscriptionProfile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, err := parseProfileIndex(r)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		_, etag, err := s.subsProfiles.Update(r.Header.Get("If-Match"), func(profiles []SubscriptionProfile) ([]SubscriptionProfile, error) {
+			if index >= len(profiles) {
+				return nil, profileNotFoundError(index)
+			}
+			return append(profiles[:index], profiles[index+1:]...), nil
+		})
+		if err != nil {
+			respondWithProfileUpdateError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag)
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("Subscription profile %d removed", index)})
+	}
+}
@@ -0,0 +1,89 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleListSubscriptionTokens handles the GET /subscription/tokens API request.
+func (s *APIServer) handleListSubscriptionTokens() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokens := s.store.SubscriptionTokens.List()
+		resp := make([]SubscriptionTokenResponse, 0, len(tokens))
+		for _, t := range tokens {
+			resp = append(resp, newSubscriptionTokenResponse(t))
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp})
+	}
+}
+
+// handleGetSubscriptionToken handles the GET /subscription/tokens/{email} API request.
+func (s *APIServer) handleGetSubscriptionToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		t, ok := s.store.SubscriptionTokens.Get(email)
+		if !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No subscription token issued for user %s", email))
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newSubscriptionTokenResponse(t)})
+	}
+}
+
+// handleIssueSubscriptionToken handles the POST /subscription/tokens/{email} API request.
+// A user that already has a token gets a new one, and the old one stops working.
+func (s *APIServer) handleIssueSubscriptionToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		if email == "" {
+			RespondWithError(w, http.StatusBadRequest, "User email is required")
+			return
+		}
+
+		// Suspended users are not in any inbound, but get their subscription back once resumed
+		if !s.store.Suspensions.IsSuspended(email) {
+			accounts, err := s.findUserAccounts(r.Context(), email)
+			if err != nil {
+				RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to look up user %s: %v", email, err))
+				return
+			}
+			if len(accounts) == 0 {
+				RespondWithError(w, http.StatusNotFound, fmt.Sprintf("User %s not found in any inbound", email))
+				return
+			}
+		}
+
+		_, rotated := s.store.SubscriptionTokens.Get(email)
+		t, err := s.issueSubscriptionToken(email)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to issue subscription token for user %s: %v", email, err))
+			return
+		}
+
+		message := fmt.Sprintf("Subscription token issued for user %s", email)
+		if rotated {
+			message = fmt.Sprintf("Subscription token of user %s rotated", email)
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newSubscriptionTokenResponse(t), Message: message})
+	}
+}
+
+// handleRevokeSubscriptionToken handles the DELETE /subscription/tokens/{email} API request.
+func (s *APIServer) handleRevokeSubscriptionToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		if _, ok := s.store.SubscriptionTokens.Get(email); !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No subscription token issued for user %s", email))
+			return
+		}
+
+		if err := s.store.SubscriptionTokens.Delete(email); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to revoke subscription token of user %s: %v", email, err))
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("Subscription token of user %s revoked", email)})
+	}
+}
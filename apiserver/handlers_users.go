@@ -0,0 +1,478 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"xray-api-bridge/store"
+)
+
+// handleListSuspendedUsers handles the GET /users/suspended API request.
+func (s *APIServer) handleListSuspendedUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		suspensions := s.store.Suspensions.List()
+		users := make([]SuspendedUserResponse, 0, len(suspensions))
+		for _, suspension := range suspensions {
+			users = append(users, newSuspendedUserResponse(suspension))
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: users})
+	}
+}
+
+// handleListUserQuotas handles the GET /users/quota API request.
+func (s *APIServer) handleListUserQuotas() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quotas := s.store.Quotas.List()
+		resp := make([]UserQuotaResponse, 0, len(quotas))
+		for _, q := range quotas {
+			resp = append(resp, s.newUserQuotaResponse(q))
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp})
+	}
+}
+
+// handleGetUserQuota handles the GET /users/{email}/quota API request.
+func (s *APIServer) handleGetUserQuota() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		q, ok := s.store.Quotas.Get(email)
+		if !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No quota set for user %s", email))
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: s.newUserQuotaResponse(q)})
+	}
+}
+
+// handleSetUserQuota handles the PUT /users/{email}/quota API request.
+// Raising the limit of a user suspended over quota puts the user back at once.
+func (s *APIServer) handleSetUserQuota() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		if email == "" {
+			RespondWithError(w, http.StatusBadRequest, "User email is required")
+			return
+		}
+
+		var request UserQuotaRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if request.Limit <= 0 {
+			RespondWithError(w, http.StatusBadRequest, "Quota limit must be a positive number of bytes")
+			return
+		}
+		if request.Period != "" && request.Period != quotaPeriodMonthly {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported quota period '%s', expected '%s'", request.Period, quotaPeriodMonthly))
+			return
+		}
+
+		s.quotaMu.Lock()
+		defer s.quotaMu.Unlock()
+
+		q, ok := s.store.Quotas.Get(email)
+		if !ok {
+			// Only traffic from now on counts against a new quota: it starts with nothing used and
+			// the current counters as the baseline later traffic is measured from
+			traffic, err := s.queryUserTraffic(r.Context(), email, false)
+			if err != nil {
+				RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read traffic of user %s: %v", email, err))
+				return
+			}
+			q.LastUplink, q.LastDownlink = traffic[email].Uplink, traffic[email].Downlink
+		}
+		if !ok || request.ResetUsage {
+			clearQuotaUsage(&q)
+			q.PeriodStart = time.Now()
+		}
+		q.Email = email
+		q.Limit = request.Limit
+		q.Period = request.Period
+
+		if err := s.store.Quotas.Put(q); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save quota of user %s: %v", email, err))
+			return
+		}
+		s.applyQuota(r.Context(), q)
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: s.newUserQuotaResponse(q), Message: fmt.Sprintf("Quota of user %s set", email)})
+	}
+}
+
+// handleResetUserQuota handles the POST /users/{email}/quota/reset API request.
+func (s *APIServer) handleResetUserQuota() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+
+		s.quotaMu.Lock()
+		defer s.quotaMu.Unlock()
+
+		q, ok := s.store.Quotas.Get(email)
+		if !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No quota set for user %s", email))
+			return
+		}
+		clearQuotaUsage(&q)
+		q.PeriodStart = time.Now()
+
+		if err := s.store.Quotas.Put(q); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save quota of user %s: %v", email, err))
+			return
+		}
+		s.applyQuota(r.Context(), q)
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: s.newUserQuotaResponse(q), Message: fmt.Sprintf("Quota of user %s reset", email)})
+	}
+}
+
+// handleRemoveUserQuota handles the DELETE /users/{email}/quota API request.
+// A user suspended over quota is put back.
+func (s *APIServer) handleRemoveUserQuota() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+
+		s.quotaMu.Lock()
+		defer s.quotaMu.Unlock()
+
+		if _, ok := s.store.Quotas.Get(email); !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No quota set for user %s", email))
+			return
+		}
+		if err := s.store.Quotas.Delete(email); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove quota of user %s: %v", email, err))
+			return
+		}
+		if err := s.resumeUser(r.Context(), email, suspendReasonQuota); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Quota of user %s removed, but the user could not be resumed: %v", email, err))
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("Quota of user %s removed", email)})
+	}
+}
+
+// handleListExpiredUsers handles the GET /users/expired API request.
+func (s *APIServer) handleListExpiredUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := make([]UserExpiryResponse, 0)
+		for _, e := range s.store.Expiries.List() {
+			if expiry := newUserExpiryResponse(e); expiry.Expired {
+				resp = append(resp, expiry)
+			}
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp})
+	}
+}
+
+// handleGetUserExpiry handles the GET /users/{email}/expiry API request.
+func (s *APIServer) handleGetUserExpiry() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		e, ok := s.store.Expiries.Get(email)
+		if !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No expiry set for user %s", email))
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newUserExpiryResponse(e)})
+	}
+}
+
+// handleSetUserExpiry handles the PUT /users/{email}/expiry API request.
+// Renewing an expired user puts the user back into every inbound it was removed from.
+func (s *APIServer) handleSetUserExpiry() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		if email == "" {
+			RespondWithError(w, http.StatusBadRequest, "User email is required")
+			return
+		}
+
+		var request UserExpiryRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if !request.ExpireAt.After(time.Now()) {
+			RespondWithError(w, http.StatusBadRequest, "expireAt must be in the future")
+			return
+		}
+
+		if err := s.setUserExpiry(r.Context(), email, request.ExpireAt); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to set expiry of user %s: %v", email, err))
+			return
+		}
+
+		e, _ := s.store.Expiries.Get(email)
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newUserExpiryResponse(e), Message: fmt.Sprintf("Expiry of user %s set", email)})
+	}
+}
+
+// handleRemoveUserExpiry handles the DELETE /users/{email}/expiry API request.
+// An expired user is put back.
+func (s *APIServer) handleRemoveUserExpiry() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		if _, ok := s.store.Expiries.Get(email); !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No expiry set for user %s", email))
+			return
+		}
+
+		if err := s.removeUserExpiry(r.Context(), email); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove expiry of user %s: %v", email, err))
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("Expiry of user %s removed", email)})
+	}
+}
+
+// handleListUserTraffic handles the GET /users/traffic?sort=<key>&order=<asc|desc>&reset=<bool> API request.
+func (s *APIServer) handleListUserTraffic() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reset, _ := strconv.ParseBool(r.URL.Query().Get("reset"))
+
+		traffic, err := s.readUserTraffic(r.Context(), "", reset)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get user traffic: %v", err))
+			return
+		}
+
+		resp := make([]UserTraffic, 0, len(traffic))
+		for _, t := range traffic {
+			resp = append(resp, t)
+		}
+		if err := sortUserTraffic(resp, r.URL.Query().Get("sort"), r.URL.Query().Get("order")); err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp})
+	}
+}
+
+// handleGetUserTraffic handles the GET /users/{email}/traffic?reset=<bool> API request.
+func (s *APIServer) handleGetUserTraffic() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		reset, _ := strconv.ParseBool(r.URL.Query().Get("reset"))
+
+		traffic, err := s.readUserTraffic(r.Context(), email, reset)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get traffic of user %s: %v", email, err))
+			return
+		}
+		t, ok := traffic[email]
+		if !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No traffic counters found for user %s", email))
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: t})
+	}
+}
+
+// handleListDeviceLimits handles the GET /users/device-limit API request.
+func (s *APIServer) handleListDeviceLimits() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limits := s.store.DeviceLimits.List()
+		resp := make([]DeviceLimitResponse, 0, len(limits))
+		for _, l := range limits {
+			resp = append(resp, newDeviceLimitResponse(l))
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: resp})
+	}
+}
+
+// handleGetDeviceLimit handles the GET /users/{email}/device-limit API request.
+func (s *APIServer) handleGetDeviceLimit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		l, ok := s.store.DeviceLimits.Get(email)
+		if !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No device limit set for user %s", email))
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newDeviceLimitResponse(l)})
+	}
+}
+
+// handleSetDeviceLimit handles the PUT /users/{email}/device-limit API request.
+// A kick or blocks already in force run until they expire.
+func (s *APIServer) handleSetDeviceLimit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		if email == "" {
+			RespondWithError(w, http.StatusBadRequest, "User email is required")
+			return
+		}
+
+		var request DeviceLimitRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if request.MaxIPs <= 0 {
+			RespondWithError(w, http.StatusBadRequest, "maxIPs must be a positive number")
+			return
+		}
+		switch request.Action {
+		case "":
+			request.Action = deviceLimitActionLog
+		case deviceLimitActionLog, deviceLimitActionWebhook, deviceLimitActionKick, deviceLimitActionBlock:
+		default:
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported action '%s', expected '%s', '%s', '%s' or '%s'", request.Action, deviceLimitActionLog, deviceLimitActionWebhook, deviceLimitActionKick, deviceLimitActionBlock))
+			return
+		}
+		duration := defaultDeviceLimitDuration
+		if request.Duration != "" {
+			d, err := time.ParseDuration(request.Duration)
+			if err != nil || d <= 0 {
+				RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid duration '%s'", request.Duration))
+				return
+			}
+			duration = d
+		}
+
+		s.deviceMu.Lock()
+		defer s.deviceMu.Unlock()
+
+		l, _ := s.store.DeviceLimits.Get(email)
+		l.Email = email
+		l.MaxIPs = request.MaxIPs
+		l.Action = request.Action
+		l.Duration = duration
+
+		if err := s.store.DeviceLimits.Put(l); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save device limit of user %s: %v", email, err))
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newDeviceLimitResponse(l), Message: fmt.Sprintf("Device limit of user %s set", email)})
+	}
+}
+
+// handleRemoveDeviceLimit handles the DELETE /users/{email}/device-limit API request.
+// A kick or blocks in force are lifted at once.
+func (s *APIServer) handleRemoveDeviceLimit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+
+		s.deviceMu.Lock()
+		defer s.deviceMu.Unlock()
+
+		l, ok := s.store.DeviceLimits.Get(email)
+		if !ok {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No device limit set for user %s", email))
+			return
+		}
+		s.liftDeviceLimitActions(r.Context(), &l, time.Now(), true)
+		if err := s.store.DeviceLimits.Delete(email); err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove device limit of user %s: %v", email, err))
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("Device limit of user %s removed", email)})
+	}
+}
+
+// handleListShortIDs handles the GET /users/short-ids?tag=<tag> API request.
+func (s *APIServer) handleListShortIDs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shortIDs := s.store.ShortIDs.List()
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			shortIDs = s.store.ShortIDs.ListByTag(tag)
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newShortIDResponses(shortIDs)})
+	}
+}
+
+// handleGetUserShortIDs handles the GET /users/{email}/short-ids API request.
+func (s *APIServer) handleGetUserShortIDs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		shortIDs := s.store.ShortIDs.ListByEmail(email)
+		if len(shortIDs) == 0 {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No REALITY shortId assigned to user %s", email))
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newShortIDResponses(shortIDs)})
+	}
+}
+
+// handleReassignUserShortID handles the PUT /users/{email}/short-ids API request.
+func (s *APIServer) handleReassignUserShortID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		if email == "" {
+			RespondWithError(w, http.StatusBadRequest, "User email is required")
+			return
+		}
+
+		var request ShortIDRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if request.Tag == "" {
+			RespondWithError(w, http.StatusBadRequest, "tag is required")
+			return
+		}
+
+		shortIDs, err := s.inboundShortIDs(r.Context(), request.Tag)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errNotRealityInbound) {
+				status = http.StatusBadRequest
+			}
+			RespondWithError(w, status, fmt.Sprintf("Failed to read REALITY shortIds: %v", err))
+			return
+		}
+
+		if _, err := s.reassignShortID(request.Tag, email, shortIDs, request.ShortID); err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to reassign REALITY shortId of user %s: %v", email, err))
+			return
+		}
+
+		sid, _ := s.store.ShortIDs.Get(request.Tag, email)
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: newShortIDResponses([]store.ShortID{sid})[0], Message: fmt.Sprintf("REALITY shortId of user %s on inbound %s set to '%s'", email, request.Tag, sid.ShortID)})
+	}
+}
+
+// handleRemoveUserShortIDs handles the DELETE /users/{email}/short-ids?tag=<tag> API request.
+// Without a tag, the assignments on every inbound are removed. The user is given a shortId again
+// when next added to the inbound, or with PUT /users/{email}/short-ids.
+func (s *APIServer) handleRemoveUserShortIDs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		shortIDs := s.store.ShortIDs.ListByEmail(email)
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			sid, ok := s.store.ShortIDs.Get(tag, email)
+			shortIDs = nil
+			if ok {
+				shortIDs = []store.ShortID{sid}
+			}
+		}
+		if len(shortIDs) == 0 {
+			RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No REALITY shortId assigned to user %s", email))
+			return
+		}
+
+		s.shortIDMu.Lock()
+		defer s.shortIDMu.Unlock()
+		for _, sid := range shortIDs {
+			if err := s.store.ShortIDs.Delete(sid.Tag, email); err != nil {
+				RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove REALITY shortId of user %s: %v", email, err))
+				return
+			}
+		}
+
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Message: fmt.Sprintf("REALITY shortIds of user %s removed", email)})
+	}
+}
@@ -0,0 +1,77 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	stats_command "github.com/xtls/xray-core/app/stats/command"
+)
+
+// maxHistoryPoints bounds the number of steps a single history query may return.
+const maxHistoryPoints = 5000
+
+// RunHistorySampler records the traffic of every user, inbound and outbound counter every interval,
+// until ctx is cancelled.
+func (s *APIServer) RunHistorySampler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sampleHistory(ctx)
+		}
+	}
+}
+
+// sampleHistory stores the traffic counted since the previous sample.
+func (s *APIServer) sampleHistory(ctx context.Context) {
+	resp, err := s.xrayClient.StatsClient.QueryStats(ctx, &stats_command.QueryStatsRequest{})
+	if err != nil {
+		log.Printf("Warning: traffic history sample skipped: %v", err)
+		return
+	}
+
+	// Counters start over with every Xray-core process
+	now := time.Now()
+	last, lastTime := s.store.History.Counters()
+	restarted := !lastTime.IsZero() && s.xrayClient.LastRestart().After(lastTime)
+
+	counters := make(map[string]int64)
+	deltas := make(map[string]int64)
+	for _, stat := range resp.GetStat() {
+		if !strings.Contains(stat.Name, ">>>traffic>>>") {
+			continue
+		}
+		counters[stat.Name] = stat.Value
+		// The very first sample only sets the baseline, as nothing tells when the counters started
+		if !lastTime.IsZero() {
+			deltas[stat.Name] = counterDelta(last[stat.Name], stat.Value, restarted)
+		}
+	}
+
+	if err := s.store.History.Add(now, deltas, counters); err != nil {
+		log.Printf("Warning: failed to persist traffic history: %v", err)
+	}
+}
+
+// parseTimeParam reads a query parameter given as RFC 3339 or as Unix seconds.
+func parseTimeParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s', expected RFC 3339 or Unix seconds", value)
+	}
+	return t, nil
+}
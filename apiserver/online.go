@@ -0,0 +1,88 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	stats_command "github.com/xtls/xray-core/app/stats/command"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// onlineStatName returns the name of the online map of a user, accepting either a bare email
+// or the full user>>>{email}>>>online name.
+func onlineStatName(name string) string {
+	if strings.Contains(name, ">>>") {
+		return name
+	}
+	return userStatPrefix + name + ">>>online"
+}
+
+// emailFromOnlineStatName extracts the email from a user>>>{email}>>>online name.
+func emailFromOnlineStatName(name string) string {
+	parts := strings.Split(name, ">>>")
+	if len(parts) == 3 && parts[0] == "user" {
+		return parts[1]
+	}
+	return name
+}
+
+// getOnlineUser reads the source IPs of an online user and when each was last seen.
+func (s *APIServer) getOnlineUser(ctx context.Context, name string) (OnlineUser, error) {
+	resp, err := s.xrayClient.StatsClient.GetStatsOnlineIpList(ctx, &stats_command.GetStatsRequest{Name: onlineStatName(name)})
+	if err != nil {
+		return OnlineUser{}, err
+	}
+
+	user := OnlineUser{
+		Email: emailFromOnlineStatName(resp.GetName()),
+		IPs:   make([]OnlineIP, 0, len(resp.GetIps())),
+	}
+	for ip, lastSeen := range resp.GetIps() {
+		user.IPs = append(user.IPs, OnlineIP{IP: ip, LastSeen: time.Unix(lastSeen, 0)})
+	}
+	// Most recently seen first, so the newest connection is easy to spot
+	sort.Slice(user.IPs, func(i, j int) bool {
+		if !user.IPs[i].LastSeen.Equal(user.IPs[j].LastSeen) {
+			return user.IPs[i].LastSeen.After(user.IPs[j].LastSeen)
+		}
+		return user.IPs[i].IP < user.IPs[j].IP
+	})
+	return user, nil
+}
+
+// listOnlineUsers reads every online user along with their source IPs. Xray-core v1.251015 has
+// no RPC listing online maps, so the users are taken from the per-user traffic counters, which
+// exist for every user with statsUserUplink/statsUserDownlink enabled, and those offline skipped.
+func (s *APIServer) listOnlineUsers(ctx context.Context) ([]OnlineUser, error) {
+	traffic, err := s.queryUserTraffic(ctx, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]OnlineUser, 0, len(traffic))
+	for email := range traffic {
+		user, err := s.getOnlineUser(ctx, email)
+		if err != nil {
+			// The user is not online
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users, nil
+}
+
+// onlineErrorStatus maps an error of the online RPCs to an HTTP status code.
+func onlineErrorStatus(err error) int {
+	if status.Code(err) == codes.NotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
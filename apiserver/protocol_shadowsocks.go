@@ -0,0 +1,205 @@
+package apiserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/xtls/xray-core/proxy/shadowsocks"
+	"github.com/xtls/xray-core/proxy/shadowsocks_2022"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	registerProtocolAdapter(shadowsocksAdapter{})
+	registerProtocolAdapter(shadowsocks2022Adapter{})
+}
+
+// shadowsocksCipherTypes maps the Shadowsocks method names used in Xray's JSON configuration to their protobuf values.
+var shadowsocksCipherTypes = map[string]shadowsocks.CipherType{
+	"aes-128-gcm":             shadowsocks.CipherType_AES_128_GCM,
+	"aead_aes_128_gcm":        shadowsocks.CipherType_AES_128_GCM,
+	"aes-256-gcm":             shadowsocks.CipherType_AES_256_GCM,
+	"aead_aes_256_gcm":        shadowsocks.CipherType_AES_256_GCM,
+	"chacha20-poly1305":       shadowsocks.CipherType_CHACHA20_POLY1305,
+	"chacha20-ietf-poly1305":  shadowsocks.CipherType_CHACHA20_POLY1305,
+	"aead_chacha20_poly1305":  shadowsocks.CipherType_CHACHA20_POLY1305,
+	"xchacha20-poly1305":      shadowsocks.CipherType_XCHACHA20_POLY1305,
+	"xchacha20-ietf-poly1305": shadowsocks.CipherType_XCHACHA20_POLY1305,
+	"aead_xchacha20_poly1305": shadowsocks.CipherType_XCHACHA20_POLY1305,
+	"none":                    shadowsocks.CipherType_NONE,
+	"plain":                   shadowsocks.CipherType_NONE,
+}
+
+// shadowsocksAdapter is the protocol adapter of Shadowsocks with the original AEAD ciphers.
+// It also encodes the share links of Shadowsocks 2022 nodes, which share the ss:// scheme.
+type shadowsocksAdapter struct{}
+
+func (shadowsocksAdapter) Name() string           { return "shadowsocks" }
+func (shadowsocksAdapter) ConfigProtocol() string { return "shadowsocks" }
+
+func (shadowsocksAdapter) Types() protocolTypes {
+	return protocolTypes{
+		Inbounds:     []proto.Message{&shadowsocks.ServerConfig{}},
+		UserInbounds: []proto.Message{&shadowsocks.ServerConfig{}},
+		Outbounds:    []proto.Message{&shadowsocks.ClientConfig{}},
+		Accounts:     []proto.Message{&shadowsocks.Account{}},
+	}
+}
+
+func (shadowsocksAdapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseShadowsocksInbound(config.(*shadowsocks.ServerConfig))
+}
+
+func (shadowsocksAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseShadowsocksOutbound(config.(*shadowsocks.ClientConfig))
+}
+
+func (shadowsocksAdapter) BuildAccount(user SimplifiedUser) (proto.Message, error) {
+	if user.Password == "" {
+		return nil, fmt.Errorf("user %s: 'password' is required for shadowsocks", user.Email)
+	}
+	cipherType, ok := shadowsocksCipherTypes[strings.ToLower(user.Method)]
+	if !ok {
+		return nil, fmt.Errorf("user %s: unsupported shadowsocks method '%s'", user.Email, user.Method)
+	}
+	return &shadowsocks.Account{
+		Password:   user.Password,
+		CipherType: cipherType,
+	}, nil
+}
+
+func (shadowsocksAdapter) SameAccount(account proto.Message, user SimplifiedUser) bool {
+	a := account.(*shadowsocks.Account)
+	cipherType, ok := shadowsocksCipherTypes[strings.ToLower(user.Method)]
+	return a.Password == user.Password && ok && a.CipherType == cipherType
+}
+
+func (shadowsocksAdapter) DecodeAccount(account proto.Message) map[string]interface{} {
+	a := account.(*shadowsocks.Account)
+	return map[string]interface{}{
+		"method":   shadowsocksCipherNames[a.CipherType],
+		"password": a.Password,
+	}
+}
+
+// ShareLink encodes the node as a SIP002 ss:// share link. The user info is base64
+// encoded, except for Shadowsocks 2022 methods whose keys are percent-encoded as SIP022 requires,
+// with the userinfo escaping of RFC 3986 rather than form encoding.
+func (shadowsocksAdapter) ShareLink(n subscriptionNode) string {
+	var userInfo string
+	if strings.HasPrefix(n.Method, "2022-") {
+		userInfo = n.Method + ":" + url.User(n.Password).String()
+	} else {
+		userInfo = base64.RawURLEncoding.EncodeToString([]byte(n.Method + ":" + n.Password))
+	}
+	return fmt.Sprintf("ss://%s@%s:%d#%s", userInfo, n.Address, n.Port, url.QueryEscape(n.Name))
+}
+
+// SubscriptionClients reads the clients of a multi-user inbound, or the single user of an inbound
+// without clients. Clients take the method of the inbound when they have none, and those of a
+// Shadowsocks 2022 multi-user inbound its key as ServerKey.
+func (shadowsocksAdapter) SubscriptionClients(settings json.RawMessage) ([]subscriptionClient, error) {
+	var config struct {
+		Clients  []subscriptionClient `json:"clients"`
+		Method   string               `json:"method"`
+		Password string               `json:"password"`
+		Email    string               `json:"email"`
+		Level    int64                `json:"level"`
+	}
+	if err := json.Unmarshal(settings, &config); err != nil {
+		return nil, err
+	}
+
+	clients := config.Clients
+	if len(clients) == 0 && config.Password != "" {
+		// Single-user inbound
+		clients = append(clients, subscriptionClient{Password: config.Password, Method: config.Method, Email: config.Email, Level: config.Level})
+	}
+	for i := range clients {
+		if clients[i].Method == "" {
+			clients[i].Method = config.Method
+		}
+		if strings.HasPrefix(clients[i].Method, "2022-") && clients[i].Password != config.Password {
+			clients[i].ServerKey = config.Password
+		}
+	}
+	return clients, nil
+}
+
+// ClashProxy sets the cipher and password of the proxy. Shadowsocks has no transport or TLS
+// options of its own.
+func (shadowsocksAdapter) ClashProxy(n subscriptionNode, proxy *clashProxy) (bool, error) {
+	proxy.Type = "ss"
+	proxy.Cipher = n.Method
+	proxy.Password = n.Password
+	return false, nil
+}
+
+// SingboxOutbound sets the method and password of the outbound. Shadowsocks has no transport or
+// TLS options of its own.
+func (shadowsocksAdapter) SingboxOutbound(n subscriptionNode, outbound *singboxOutbound) (bool, error) {
+	outbound.Method = n.Method
+	outbound.Password = n.Password
+	return false, nil
+}
+
+func (shadowsocksAdapter) XrayOutboundSettings(n subscriptionNode) map[string]interface{} {
+	return xrayServersSettings(n, map[string]interface{}{"method": n.Method, "password": n.Password})
+}
+
+// shadowsocks2022Adapter is the protocol adapter of Shadowsocks 2022. Its users are managed
+// under "shadowsocks-2022", as their accounts differ from those of the original ciphers.
+type shadowsocks2022Adapter struct{}
+
+func (shadowsocks2022Adapter) Name() string           { return "shadowsocks-2022" }
+func (shadowsocks2022Adapter) ConfigProtocol() string { return "shadowsocks" }
+
+func (shadowsocks2022Adapter) Types() protocolTypes {
+	return protocolTypes{
+		Inbounds: []proto.Message{
+			&shadowsocks_2022.ServerConfig{},
+			&shadowsocks_2022.MultiUserServerConfig{},
+			&shadowsocks_2022.RelayServerConfig{},
+		},
+		UserInbounds: []proto.Message{&shadowsocks_2022.MultiUserServerConfig{}},
+		Outbounds:    []proto.Message{&shadowsocks_2022.ClientConfig{}},
+		Accounts:     []proto.Message{&shadowsocks_2022.Account{}},
+	}
+}
+
+func (shadowsocks2022Adapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	switch c := config.(type) {
+	case *shadowsocks_2022.ServerConfig:
+		return ReverseShadowsocks2022Inbound(c)
+	case *shadowsocks_2022.MultiUserServerConfig:
+		return ReverseShadowsocks2022MultiUserInbound(c)
+	default:
+		return ReverseShadowsocks2022RelayInbound(config.(*shadowsocks_2022.RelayServerConfig))
+	}
+}
+
+func (shadowsocks2022Adapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseShadowsocks2022Outbound(config.(*shadowsocks_2022.ClientConfig))
+}
+
+func (shadowsocks2022Adapter) BuildAccount(user SimplifiedUser) (proto.Message, error) {
+	if user.Password == "" {
+		return nil, fmt.Errorf("user %s: 'password' (base64 user key) is required for shadowsocks-2022", user.Email)
+	}
+	return &shadowsocks_2022.Account{
+		Key: user.Password,
+	}, nil
+}
+
+func (shadowsocks2022Adapter) SameAccount(account proto.Message, user SimplifiedUser) bool {
+	return account.(*shadowsocks_2022.Account).Key == user.Password
+}
+
+func (shadowsocks2022Adapter) DecodeAccount(account proto.Message) map[string]interface{} {
+	return map[string]interface{}{
+		"password": account.(*shadowsocks_2022.Account).Key,
+	}
+}
@@ -0,0 +1,134 @@
+package apiserver
+
+import (
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestShadowsocksShareLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     subscriptionNode
+		wantSIP  string // SIP002 for base64 encoded user info, SIP022 for percent-encoded
+		password string
+	}{
+		{
+			name:     "SIP002",
+			node:     subscriptionNode{Name: "ss", Address: "example.com", Port: 8388, Method: "aes-128-gcm", Password: "secret"},
+			wantSIP:  "SIP002",
+			password: "secret",
+		},
+		{
+			name:     "SIP002 with reserved characters",
+			node:     subscriptionNode{Name: "ss-reserved", Address: "192.0.2.1", Port: 443, Method: "chacha20-ietf-poly1305", Password: "p@ss:w/rd?#% +"},
+			wantSIP:  "SIP002",
+			password: "p@ss:w/rd?#% +",
+		},
+		{
+			name:     "SIP022 single key",
+			node:     subscriptionNode{Name: "ss2022", Address: "example.com", Port: 443, Method: "2022-blake3-aes-128-gcm", Password: "Ni+ZvK8B/2lbKW6zWy8CpQ=="},
+			wantSIP:  "SIP022",
+			password: "Ni+ZvK8B/2lbKW6zWy8CpQ==",
+		},
+		{
+			name:     "SIP022 multi-user keys",
+			node:     subscriptionNode{Name: "ss2022-multi", Address: "example.com", Port: 443, Method: "2022-blake3-aes-256-gcm", Password: "tHmmLaOF+cEO1lMNR0vmTQ7Ndy/9ZPxm2BPpj9NhEQs=:W2fLpAZbl5AlE/QQcOp6yCjqs3/i9nCgTBBSxDg3gYk="},
+			wantSIP:  "SIP022",
+			password: "tHmmLaOF+cEO1lMNR0vmTQ7Ndy/9ZPxm2BPpj9NhEQs=:W2fLpAZbl5AlE/QQcOp6yCjqs3/i9nCgTBBSxDg3gYk=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.node.Protocol = "shadowsocks"
+			link, err := url.Parse(tt.node.shareLink())
+			if err != nil {
+				t.Fatalf("share link does not parse: %v", err)
+			}
+			if link.Scheme != "ss" || link.Hostname() != tt.node.Address || link.Port() != strconv.Itoa(int(tt.node.Port)) {
+				t.Errorf("share link = %s, want ss://...@%s:%d", link, tt.node.Address, tt.node.Port)
+			}
+
+			var method, password string
+			switch tt.wantSIP {
+			case "SIP002":
+				userInfo, err := base64.RawURLEncoding.DecodeString(link.User.Username())
+				if err != nil {
+					t.Fatalf("user info is not unpadded base64url: %v", err)
+				}
+				method, password, _ = strings.Cut(string(userInfo), ":")
+			case "SIP022":
+				method = link.User.Username()
+				password, _ = link.User.Password()
+			}
+			if method != tt.node.Method || password != tt.password {
+				t.Errorf("decoded credentials = %q:%q, want %q:%q", method, password, tt.node.Method, tt.password)
+			}
+
+			if name, err := url.QueryUnescape(link.EscapedFragment()); err != nil || name != tt.node.Name {
+				t.Errorf("name = %q (%v), want %q", name, err, tt.node.Name)
+			}
+		})
+	}
+}
+
+func TestShadowsocksSubscriptionClients(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		want     []subscriptionClient
+	}{
+		{
+			name:     "single user",
+			settings: `{"method": "aes-128-gcm", "password": "secret", "email": "a@example.com", "level": 1}`,
+			want:     []subscriptionClient{{Password: "secret", Method: "aes-128-gcm", Email: "a@example.com", Level: 1}},
+		},
+		{
+			name:     "single user 2022",
+			settings: `{"method": "2022-blake3-aes-128-gcm", "password": "Ni+ZvK8B/2lbKW6zWy8CpQ==", "email": "a@example.com"}`,
+			want:     []subscriptionClient{{Password: "Ni+ZvK8B/2lbKW6zWy8CpQ==", Method: "2022-blake3-aes-128-gcm", Email: "a@example.com"}},
+		},
+		{
+			name: "multi-user 2022",
+			settings: `{"method": "2022-blake3-aes-128-gcm", "password": "Ni+ZvK8B/2lbKW6zWy8CpQ==", "clients": [
+				{"password": "J2X1hNtYjcs2oiVdPHQu0w==", "email": "a@example.com", "level": 1},
+				{"password": "oXx2+bWDr7ED/Z3B4RBbRw==", "email": "b@example.com"}
+			]}`,
+			want: []subscriptionClient{
+				{Password: "J2X1hNtYjcs2oiVdPHQu0w==", Method: "2022-blake3-aes-128-gcm", Email: "a@example.com", Level: 1, ServerKey: "Ni+ZvK8B/2lbKW6zWy8CpQ=="},
+				{Password: "oXx2+bWDr7ED/Z3B4RBbRw==", Method: "2022-blake3-aes-128-gcm", Email: "b@example.com", ServerKey: "Ni+ZvK8B/2lbKW6zWy8CpQ=="},
+			},
+		},
+		{
+			name: "multi-user with own methods",
+			settings: `{"clients": [
+				{"method": "aes-256-gcm", "password": "one", "email": "a@example.com"},
+				{"method": "chacha20-ietf-poly1305", "password": "two", "email": "b@example.com"}
+			]}`,
+			want: []subscriptionClient{
+				{Password: "one", Method: "aes-256-gcm", Email: "a@example.com"},
+				{Password: "two", Method: "chacha20-ietf-poly1305", Email: "b@example.com"},
+			},
+		},
+		{
+			name:     "no users",
+			settings: `{"method": "aes-128-gcm"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shadowsocksAdapter{}.SubscriptionClients([]byte(tt.settings))
+			if err != nil {
+				t.Fatalf("SubscriptionClients: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clients = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package apiserver
+
+import (
+	"encoding/json"
+
+	"github.com/xtls/xray-core/proxy/blackhole"
+	"github.com/xtls/xray-core/proxy/dns"
+	"github.com/xtls/xray-core/proxy/dokodemo"
+	"github.com/xtls/xray-core/proxy/freedom"
+	"github.com/xtls/xray-core/proxy/loopback"
+	"github.com/xtls/xray-core/proxy/wireguard"
+	"google.golang.org/protobuf/proto"
+)
+
+// Adapters of the protocols without users, which are only reverse mapped.
+
+func init() {
+	registerProtocolAdapter(wireguardAdapter{})
+	registerProtocolAdapter(dokodemoAdapter{})
+	registerProtocolAdapter(freedomAdapter{})
+	registerProtocolAdapter(blackholeAdapter{})
+	registerProtocolAdapter(dnsAdapter{})
+	registerProtocolAdapter(loopbackAdapter{})
+}
+
+// wireguardAdapter is the protocol adapter of WireGuard, whose inbounds and outbounds share a config.
+type wireguardAdapter struct{}
+
+func (wireguardAdapter) Name() string           { return "wireguard" }
+func (wireguardAdapter) ConfigProtocol() string { return "wireguard" }
+
+func (wireguardAdapter) Types() protocolTypes {
+	return protocolTypes{
+		Inbounds:  []proto.Message{&wireguard.DeviceConfig{}},
+		Outbounds: []proto.Message{&wireguard.DeviceConfig{}},
+	}
+}
+
+func (wireguardAdapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseWireguardInbound(config.(*wireguard.DeviceConfig))
+}
+
+func (wireguardAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseWireguardOutbound(config.(*wireguard.DeviceConfig))
+}
+
+// dokodemoAdapter is the protocol adapter of dokodemo-door.
+type dokodemoAdapter struct{}
+
+func (dokodemoAdapter) Name() string           { return "dokodemo-door" }
+func (dokodemoAdapter) ConfigProtocol() string { return "dokodemo-door" }
+
+func (dokodemoAdapter) Types() protocolTypes {
+	return protocolTypes{Inbounds: []proto.Message{&dokodemo.Config{}}}
+}
+
+func (dokodemoAdapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseDokodemoInbound(config.(*dokodemo.Config))
+}
+
+// freedomAdapter is the protocol adapter of freedom.
+type freedomAdapter struct{}
+
+func (freedomAdapter) Name() string           { return "freedom" }
+func (freedomAdapter) ConfigProtocol() string { return "freedom" }
+
+func (freedomAdapter) Types() protocolTypes {
+	return protocolTypes{Outbounds: []proto.Message{&freedom.Config{}}}
+}
+
+func (freedomAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseFreedomOutbound(config.(*freedom.Config))
+}
+
+// blackholeAdapter is the protocol adapter of blackhole.
+type blackholeAdapter struct{}
+
+func (blackholeAdapter) Name() string           { return "blackhole" }
+func (blackholeAdapter) ConfigProtocol() string { return "blackhole" }
+
+func (blackholeAdapter) Types() protocolTypes {
+	return protocolTypes{Outbounds: []proto.Message{&blackhole.Config{}}}
+}
+
+func (blackholeAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseBlackholeOutbound(config.(*blackhole.Config))
+}
+
+// dnsAdapter is the protocol adapter of the dns outbound.
+type dnsAdapter struct{}
+
+func (dnsAdapter) Name() string           { return "dns" }
+func (dnsAdapter) ConfigProtocol() string { return "dns" }
+
+func (dnsAdapter) Types() protocolTypes {
+	return protocolTypes{Outbounds: []proto.Message{&dns.Config{}}}
+}
+
+func (dnsAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseDNSOutbound(config.(*dns.Config))
+}
+
+// loopbackAdapter is the protocol adapter of loopback.
+type loopbackAdapter struct{}
+
+func (loopbackAdapter) Name() string           { return "loopback" }
+func (loopbackAdapter) ConfigProtocol() string { return "loopback" }
+
+func (loopbackAdapter) Types() protocolTypes {
+	return protocolTypes{Outbounds: []proto.Message{&loopback.Config{}}}
+}
+
+func (loopbackAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseLoopbackOutbound(config.(*loopback.Config))
+}
@@ -0,0 +1,75 @@
+package apiserver
+
+import (
+	"encoding/json"
+
+	http_proxy "github.com/xtls/xray-core/proxy/http"
+	"github.com/xtls/xray-core/proxy/socks"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	registerProtocolAdapter(socksAdapter{})
+	registerProtocolAdapter(httpAdapter{})
+}
+
+// socksAdapter is the protocol adapter of SOCKS. Socks inbounds do not implement
+// proxy.UserManager, so their accounts are only decoded, not managed.
+type socksAdapter struct{}
+
+func (socksAdapter) Name() string           { return "socks" }
+func (socksAdapter) ConfigProtocol() string { return "socks" }
+
+func (socksAdapter) Types() protocolTypes {
+	return protocolTypes{
+		Inbounds:  []proto.Message{&socks.ServerConfig{}},
+		Outbounds: []proto.Message{&socks.ClientConfig{}},
+		Accounts:  []proto.Message{&socks.Account{}},
+	}
+}
+
+func (socksAdapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseSocksInbound(config.(*socks.ServerConfig))
+}
+
+func (socksAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseSocksOutbound(config.(*socks.ClientConfig))
+}
+
+func (socksAdapter) DecodeAccount(account proto.Message) map[string]interface{} {
+	a := account.(*socks.Account)
+	return map[string]interface{}{
+		"username": a.Username,
+		"password": a.Password,
+	}
+}
+
+// httpAdapter is the protocol adapter of the HTTP proxy. Like socks, its users are not managed.
+type httpAdapter struct{}
+
+func (httpAdapter) Name() string           { return "http" }
+func (httpAdapter) ConfigProtocol() string { return "http" }
+
+func (httpAdapter) Types() protocolTypes {
+	return protocolTypes{
+		Inbounds:  []proto.Message{&http_proxy.ServerConfig{}},
+		Outbounds: []proto.Message{&http_proxy.ClientConfig{}},
+		Accounts:  []proto.Message{&http_proxy.Account{}},
+	}
+}
+
+func (httpAdapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseHTTPInbound(config.(*http_proxy.ServerConfig))
+}
+
+func (httpAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseHTTPOutbound(config.(*http_proxy.ClientConfig))
+}
+
+func (httpAdapter) DecodeAccount(account proto.Message) map[string]interface{} {
+	a := account.(*http_proxy.Account)
+	return map[string]interface{}{
+		"username": a.Username,
+		"password": a.Password,
+	}
+}
@@ -0,0 +1,82 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/xtls/xray-core/proxy/trojan"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	registerProtocolAdapter(trojanAdapter{})
+}
+
+// trojanAdapter is the protocol adapter of Trojan.
+type trojanAdapter struct{}
+
+func (trojanAdapter) Name() string           { return "trojan" }
+func (trojanAdapter) ConfigProtocol() string { return "trojan" }
+
+func (trojanAdapter) Types() protocolTypes {
+	return protocolTypes{
+		Inbounds:     []proto.Message{&trojan.ServerConfig{}},
+		UserInbounds: []proto.Message{&trojan.ServerConfig{}},
+		Outbounds:    []proto.Message{&trojan.ClientConfig{}},
+		Accounts:     []proto.Message{&trojan.Account{}},
+	}
+}
+
+func (trojanAdapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseTrojanInbound(config.(*trojan.ServerConfig))
+}
+
+func (trojanAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseTrojanOutbound(config.(*trojan.ClientConfig))
+}
+
+func (trojanAdapter) BuildAccount(user SimplifiedUser) (proto.Message, error) {
+	if user.Password == "" {
+		return nil, fmt.Errorf("user %s: 'password' is required for trojan", user.Email)
+	}
+	return &trojan.Account{
+		Password: user.Password,
+	}, nil
+}
+
+func (trojanAdapter) SameAccount(account proto.Message, user SimplifiedUser) bool {
+	return account.(*trojan.Account).Password == user.Password
+}
+
+func (trojanAdapter) DecodeAccount(account proto.Message) map[string]interface{} {
+	return map[string]interface{}{
+		"password": account.(*trojan.Account).Password,
+	}
+}
+
+// ShareLink encodes the node as a trojan:// share link, with the password escaped as URL userinfo.
+func (trojanAdapter) ShareLink(n subscriptionNode) string {
+	return n.urlShareLink(url.User(n.Password).String(), "")
+}
+
+func (trojanAdapter) SubscriptionClients(settings json.RawMessage) ([]subscriptionClient, error) {
+	return decodeSubscriptionClients(settings)
+}
+
+// ClashProxy sets the password of the proxy. Trojan always uses TLS, whose server name Clash.Meta
+// takes as sni.
+func (trojanAdapter) ClashProxy(n subscriptionNode, proxy *clashProxy) (bool, error) {
+	proxy.Password = n.Password
+	proxy.sniOnly = true
+	return true, nil
+}
+
+func (trojanAdapter) SingboxOutbound(n subscriptionNode, outbound *singboxOutbound) (bool, error) {
+	outbound.Password = n.Password
+	return true, nil
+}
+
+func (trojanAdapter) XrayOutboundSettings(n subscriptionNode) map[string]interface{} {
+	return xrayServersSettings(n, map[string]interface{}{"password": n.Password})
+}
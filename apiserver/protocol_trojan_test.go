@@ -0,0 +1,55 @@
+package apiserver
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestTrojanShareLink(t *testing.T) {
+	tests := []struct {
+		name      string
+		node      subscriptionNode
+		wantQuery url.Values
+	}{
+		{
+			name:      "tls over raw",
+			node:      subscriptionNode{Address: "example.com", Port: 443, Password: "secret", Network: "raw", Security: "tls", ServerName: "sni.example.com", Fingerprint: "chrome"},
+			wantQuery: url.Values{"security": {"tls"}, "sni": {"sni.example.com"}, "fp": {"chrome"}},
+		},
+		{
+			name:      "password with a space",
+			node:      subscriptionNode{Address: "example.com", Port: 443, Password: "two words", Network: "raw", Security: "tls"},
+			wantQuery: url.Values{"security": {"tls"}},
+		},
+		{
+			name:      "password with reserved characters",
+			node:      subscriptionNode{Address: "192.0.2.1", Port: 8443, Password: "p@ss:w/rd?#%+=&", Network: "grpc", Security: "none", ServiceName: "svc", Mode: "gun"},
+			wantQuery: url.Values{"type": {"grpc"}, "serviceName": {"svc"}, "mode": {"gun"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.node.Protocol = "trojan"
+			tt.node.Name = tt.name
+			link, err := url.Parse(tt.node.shareLink())
+			if err != nil {
+				t.Fatalf("share link does not parse: %v", err)
+			}
+			if link.Scheme != "trojan" || link.Hostname() != tt.node.Address {
+				t.Errorf("share link = %s, want trojan://...@%s", link, tt.node.Address)
+			}
+			if password := link.User.Username(); password != tt.node.Password {
+				t.Errorf("password = %q, want %q", password, tt.node.Password)
+			}
+			if _, ok := link.User.Password(); ok {
+				t.Errorf("user info %q splits into a user and a password", link.User)
+			}
+			for key := range tt.wantQuery {
+				if got, want := link.Query().Get(key), tt.wantQuery.Get(key); got != want {
+					t.Errorf("query %s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
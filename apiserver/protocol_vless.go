@@ -0,0 +1,104 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	vless "github.com/xtls/xray-core/proxy/vless"
+	vless_inbound "github.com/xtls/xray-core/proxy/vless/inbound"
+	vless_outbound "github.com/xtls/xray-core/proxy/vless/outbound"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	registerProtocolAdapter(vlessAdapter{})
+}
+
+// vlessAdapter is the protocol adapter of VLESS.
+type vlessAdapter struct{}
+
+func (vlessAdapter) Name() string           { return "vless" }
+func (vlessAdapter) ConfigProtocol() string { return "vless" }
+
+func (vlessAdapter) Types() protocolTypes {
+	return protocolTypes{
+		Inbounds:     []proto.Message{&vless_inbound.Config{}},
+		UserInbounds: []proto.Message{&vless_inbound.Config{}},
+		Outbounds:    []proto.Message{&vless_outbound.Config{}},
+		Accounts:     []proto.Message{&vless.Account{}},
+	}
+}
+
+func (vlessAdapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseVlessInbound(config.(*vless_inbound.Config))
+}
+
+func (vlessAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseVlessOutbound(config.(*vless_outbound.Config))
+}
+
+func (vlessAdapter) BuildAccount(user SimplifiedUser) (proto.Message, error) {
+	if user.ID == "" {
+		return nil, fmt.Errorf("user %s: 'id' is required for vless", user.Email)
+	}
+	return &vless.Account{
+		Id:   user.ID,
+		Flow: user.Flow,
+	}, nil
+}
+
+func (vlessAdapter) SameAccount(account proto.Message, user SimplifiedUser) bool {
+	a := account.(*vless.Account)
+	return a.Id == user.ID && a.Flow == user.Flow
+}
+
+func (vlessAdapter) DecodeAccount(account proto.Message) map[string]interface{} {
+	a := account.(*vless.Account)
+	return map[string]interface{}{
+		"id":   a.Id,
+		"flow": a.Flow,
+	}
+}
+
+func (vlessAdapter) ShareLink(n subscriptionNode) string {
+	encryption := ""
+	if n.Encryption != "" && n.Encryption != "none" {
+		encryption = url.QueryEscape(n.Encryption)
+	}
+	return n.urlShareLink(n.ID, encryption)
+}
+
+func (vlessAdapter) SubscriptionClients(settings json.RawMessage) ([]subscriptionClient, error) {
+	return decodeSubscriptionClients(settings)
+}
+
+func (vlessAdapter) ClashProxy(n subscriptionNode, proxy *clashProxy) (bool, error) {
+	proxy.UUID = n.ID
+	if n.Encryption != "" && n.Encryption != "none" {
+		proxy.Encryption = n.Encryption
+	}
+	proxy.Flow = n.Flow
+	return true, nil
+}
+
+func (vlessAdapter) SingboxOutbound(n subscriptionNode, outbound *singboxOutbound) (bool, error) {
+	if n.Encryption != "" && n.Encryption != "none" {
+		return false, fmt.Errorf("VLESS encryption is not supported by sing-box")
+	}
+	outbound.UUID = n.ID
+	outbound.Flow = n.Flow
+	outbound.PacketEncoding = "xudp"
+	return true, nil
+}
+
+func (vlessAdapter) XrayOutboundSettings(n subscriptionNode) map[string]interface{} {
+	user := map[string]interface{}{"encryption": n.Encryption}
+	if n.Encryption == "" {
+		user["encryption"] = "none"
+	}
+	if n.Flow != "" {
+		user["flow"] = n.Flow
+	}
+	return xrayVnextSettings(n, user)
+}
@@ -0,0 +1,202 @@
+package apiserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/proxy/vmess"
+	vmess_inbound "github.com/xtls/xray-core/proxy/vmess/inbound"
+	vmess_outbound "github.com/xtls/xray-core/proxy/vmess/outbound"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	registerProtocolAdapter(vmessAdapter{})
+}
+
+// vmessSecurityTypes maps the VMess security names used in Xray's JSON configuration to their protobuf values.
+var vmessSecurityTypes = map[string]protocol.SecurityType{
+	"":                  protocol.SecurityType_AUTO,
+	"auto":              protocol.SecurityType_AUTO,
+	"aes-128-gcm":       protocol.SecurityType_AES128_GCM,
+	"chacha20-poly1305": protocol.SecurityType_CHACHA20_POLY1305,
+	"none":              protocol.SecurityType_NONE,
+	"zero":              protocol.SecurityType_ZERO,
+}
+
+// vmessLinkStyleURL makes a vmess profile use the VLESS-style share link instead of the
+// base64 JSON link most clients expect.
+const vmessLinkStyleURL = "url"
+
+// vmessLink is the JSON object encoded in a standard vmess:// share link, as defined by v2rayN.
+type vmessLink struct {
+	V    string `json:"v"`
+	PS   string `json:"ps"`
+	Add  string `json:"add"`
+	Port string `json:"port"`
+	ID   string `json:"id"`
+	Aid  string `json:"aid"`
+	Scy  string `json:"scy"`
+	Net  string `json:"net"`
+	Type string `json:"type"`
+	Host string `json:"host"`
+	Path string `json:"path"`
+	TLS  string `json:"tls"`
+	SNI  string `json:"sni"`
+	Alpn string `json:"alpn"`
+	FP   string `json:"fp"`
+}
+
+// vmessAdapter is the protocol adapter of VMess.
+type vmessAdapter struct{}
+
+func (vmessAdapter) Name() string           { return "vmess" }
+func (vmessAdapter) ConfigProtocol() string { return "vmess" }
+
+func (vmessAdapter) Types() protocolTypes {
+	return protocolTypes{
+		Inbounds:     []proto.Message{&vmess_inbound.Config{}},
+		UserInbounds: []proto.Message{&vmess_inbound.Config{}},
+		Outbounds:    []proto.Message{&vmess_outbound.Config{}},
+		Accounts:     []proto.Message{&vmess.Account{}},
+	}
+}
+
+func (vmessAdapter) ReverseInbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseVmessInbound(config.(*vmess_inbound.Config))
+}
+
+func (vmessAdapter) ReverseOutbound(config proto.Message) (json.RawMessage, error) {
+	return ReverseVmessOutbound(config.(*vmess_outbound.Config))
+}
+
+func (vmessAdapter) BuildAccount(user SimplifiedUser) (proto.Message, error) {
+	if user.ID == "" {
+		return nil, fmt.Errorf("user %s: 'id' is required for vmess", user.Email)
+	}
+	securityType, ok := vmessSecurityTypes[strings.ToLower(user.Security)]
+	if !ok {
+		return nil, fmt.Errorf("user %s: unsupported vmess security '%s'", user.Email, user.Security)
+	}
+	return &vmess.Account{
+		Id:               user.ID,
+		SecuritySettings: &protocol.SecurityConfig{Type: securityType},
+	}, nil
+}
+
+func (vmessAdapter) SameAccount(account proto.Message, user SimplifiedUser) bool {
+	return account.(*vmess.Account).Id == user.ID
+}
+
+func (vmessAdapter) DecodeAccount(account proto.Message) map[string]interface{} {
+	a := account.(*vmess.Account)
+	security := "auto"
+	if a.SecuritySettings != nil {
+		for name, securityType := range vmessSecurityTypes {
+			if name != "" && name != "auto" && securityType == a.SecuritySettings.Type {
+				security = name
+			}
+		}
+	}
+	return map[string]interface{}{
+		"id":       a.Id,
+		"security": security,
+	}
+}
+
+// ShareLink encodes the node as the standard base64 JSON link, or as a VLESS-style link when the
+// profile asks for the "url" link style.
+func (vmessAdapter) ShareLink(n subscriptionNode) string {
+	if n.LinkStyle == vmessLinkStyleURL {
+		encryption := ""
+		if n.Encryption != "auto" {
+			encryption = n.Encryption
+		}
+		return n.urlShareLink(n.ID, encryption)
+	}
+	return n.vmessShareLink()
+}
+
+func (vmessAdapter) SubscriptionClients(settings json.RawMessage) ([]subscriptionClient, error) {
+	return decodeSubscriptionClients(settings)
+}
+
+func (vmessAdapter) ClashProxy(n subscriptionNode, proxy *clashProxy) (bool, error) {
+	alterID := 0
+	proxy.UUID = n.ID
+	proxy.AlterID = &alterID
+	proxy.Cipher = n.Encryption
+	if proxy.Cipher == "" {
+		proxy.Cipher = "auto"
+	}
+	return true, nil
+}
+
+func (vmessAdapter) SingboxOutbound(n subscriptionNode, outbound *singboxOutbound) (bool, error) {
+	alterID := 0
+	outbound.UUID = n.ID
+	outbound.AlterID = &alterID
+	outbound.Security = n.Encryption
+	if outbound.Security == "" {
+		outbound.Security = "auto"
+	}
+	return true, nil
+}
+
+func (vmessAdapter) XrayOutboundSettings(n subscriptionNode) map[string]interface{} {
+	user := map[string]interface{}{"security": n.Encryption}
+	if n.Encryption == "" {
+		user["security"] = "auto"
+	}
+	return xrayVnextSettings(n, user)
+}
+
+// vmessShareLink encodes the node as a standard vmess://base64(JSON) share link.
+func (n subscriptionNode) vmessShareLink() string {
+	link := vmessLink{
+		V:    "2",
+		PS:   n.Name,
+		Add:  n.Address,
+		Port: strconv.Itoa(int(n.Port)),
+		ID:   n.ID,
+		Aid:  "0",
+		Scy:  n.Encryption,
+		Net:  n.Network,
+		Type: "none",
+		Host: n.Host,
+		Path: n.Path,
+		SNI:  n.ServerName,
+		Alpn: strings.Join(n.Alpn, ","),
+		FP:   n.Fingerprint,
+	}
+	if link.Scy == "" {
+		link.Scy = "auto"
+	}
+	if n.Security != "none" {
+		link.TLS = n.Security
+	}
+
+	switch n.Network {
+	case "raw":
+		link.Net = "tcp"
+	case "http":
+		link.Net = "h2"
+	case "xhttp":
+		link.Type = n.Mode
+	case "grpc":
+		link.Type = n.Mode
+		link.Path = n.ServiceName
+	case "kcp":
+		if n.HeaderType != "" {
+			link.Type = n.HeaderType
+		}
+		link.Path = n.Seed
+	}
+
+	data, _ := json.Marshal(link)
+	return "vmess://" + base64.StdEncoding.EncodeToString(data)
+}
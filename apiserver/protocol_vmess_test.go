@@ -0,0 +1,98 @@
+package apiserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestVmessShareLink(t *testing.T) {
+	const id = "b831381d-6324-4d53-ad4f-8cda48b30811"
+	tests := []struct {
+		name string
+		node subscriptionNode
+		want vmessLink
+	}{
+		{
+			name: "raw without security",
+			node: subscriptionNode{Name: "vmess raw", Address: "example.com", Port: 80, ID: id, Network: "raw", Security: "none"},
+			want: vmessLink{V: "2", PS: "vmess raw", Add: "example.com", Port: "80", ID: id, Aid: "0", Scy: "auto", Net: "tcp", Type: "none"},
+		},
+		{
+			name: "ws with tls",
+			node: subscriptionNode{
+				Name: "节点 ws", Address: "example.com", Port: 443, ID: id, Encryption: "aes-128-gcm", Network: "ws", Security: "tls",
+				Host: "cdn.example.com", Path: "/ws?ed=2048", ServerName: "sni.example.com", Alpn: []string{"h2", "http/1.1"}, Fingerprint: "chrome",
+			},
+			want: vmessLink{
+				V: "2", PS: "节点 ws", Add: "example.com", Port: "443", ID: id, Aid: "0", Scy: "aes-128-gcm", Net: "ws", Type: "none",
+				Host: "cdn.example.com", Path: "/ws?ed=2048", TLS: "tls", SNI: "sni.example.com", Alpn: "h2,http/1.1", FP: "chrome",
+			},
+		},
+		{
+			name: "http as h2",
+			node: subscriptionNode{Address: "example.com", Port: 443, ID: id, Network: "http", Security: "tls", Host: "a.example.com,b.example.com", Path: "/h2"},
+			want: vmessLink{V: "2", Add: "example.com", Port: "443", ID: id, Aid: "0", Scy: "auto", Net: "h2", Type: "none", Host: "a.example.com,b.example.com", Path: "/h2", TLS: "tls"},
+		},
+		{
+			name: "grpc service name as path",
+			node: subscriptionNode{Address: "example.com", Port: 443, ID: id, Network: "grpc", Security: "reality", Mode: "multi", ServiceName: "svc", ServerName: "www.example.com", Fingerprint: "firefox"},
+			want: vmessLink{V: "2", Add: "example.com", Port: "443", ID: id, Aid: "0", Scy: "auto", Net: "grpc", Type: "multi", Path: "svc", TLS: "reality", SNI: "www.example.com", FP: "firefox"},
+		},
+		{
+			name: "xhttp mode as type",
+			node: subscriptionNode{Address: "example.com", Port: 443, ID: id, Network: "xhttp", Security: "tls", Mode: "packet-up", Host: "example.com", Path: "/x"},
+			want: vmessLink{V: "2", Add: "example.com", Port: "443", ID: id, Aid: "0", Scy: "auto", Net: "xhttp", Type: "packet-up", Host: "example.com", Path: "/x", TLS: "tls"},
+		},
+		{
+			name: "kcp header and seed",
+			node: subscriptionNode{Address: "example.com", Port: 8443, ID: id, Network: "kcp", Security: "none", HeaderType: "wechat-video", Seed: "s33d"},
+			want: vmessLink{V: "2", Add: "example.com", Port: "8443", ID: id, Aid: "0", Scy: "auto", Net: "kcp", Type: "wechat-video", Path: "s33d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.node.Protocol = "vmess"
+			link := tt.node.shareLink()
+
+			encoded, ok := strings.CutPrefix(link, "vmess://")
+			if !ok {
+				t.Fatalf("link %q does not start with vmess://", link)
+			}
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				t.Fatalf("link is not standard base64: %v", err)
+			}
+			var got vmessLink
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("link does not hold a JSON object: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("decoded link = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVmessURLShareLink(t *testing.T) {
+	node := subscriptionNode{
+		Name: "vmess url", Protocol: "vmess", Address: "example.com", Port: 443, ID: "b831381d-6324-4d53-ad4f-8cda48b30811",
+		Encryption: "aes-128-gcm", Network: "ws", Security: "tls", Host: "example.com", Path: "/ws", LinkStyle: vmessLinkStyleURL,
+	}
+	link, err := url.Parse(node.shareLink())
+	if err != nil {
+		t.Fatalf("share link does not parse: %v", err)
+	}
+	if link.Scheme != "vmess" || link.User.Username() != node.ID || link.Hostname() != node.Address || link.Port() != "443" {
+		t.Errorf("share link = %s, want vmess://%s@%s:443", link, node.ID, node.Address)
+	}
+	if got := link.Query().Get("encryption"); got != node.Encryption {
+		t.Errorf("encryption = %q, want %q", got, node.Encryption)
+	}
+	if got := link.Query().Get("type"); got != node.Network {
+		t.Errorf("type = %q, want %q", got, node.Network)
+	}
+}
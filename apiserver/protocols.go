@@ -0,0 +1,212 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/xtls/xray-core/common/serial"
+	"google.golang.org/protobuf/proto"
+)
+
+// protocolAdapter is the support of the bridge for one proxy protocol. Each adapter registers
+// itself with registerProtocolAdapter from the file it is defined in, under the type URLs of the
+// messages it handles, so that adding a protocol means adding one adapter.
+//
+// What an adapter can do beyond naming its protocol is given by the optional interfaces below:
+// inboundReverser and outboundReverser for the configs it lists, accountDecoder for protocols
+// with accounts, accountAdapter for those whose inbounds manage users, and subscriptionAdapter
+// for protocols subscriptions can be generated for.
+type protocolAdapter interface {
+	// Name is the name users of the protocol are managed under, e.g. "vless" or "shadowsocks-2022".
+	Name() string
+	// ConfigProtocol is the protocol name used in Xray's JSON configuration, e.g. "shadowsocks".
+	ConfigProtocol() string
+	// Types lists the messages the adapter handles.
+	Types() protocolTypes
+}
+
+// protocolTypes lists the messages handled by a protocol adapter, by example value.
+type protocolTypes struct {
+	Inbounds     []proto.Message // inbound configs, reverse mapped by the adapter
+	UserInbounds []proto.Message // those of Inbounds whose users are managed with the adapter's accounts
+	Outbounds    []proto.Message // outbound configs, reverse mapped by the adapter
+	Accounts     []proto.Message // user accounts, decoded by the adapter
+}
+
+// inboundReverser is implemented by adapters that list inbound configs.
+type inboundReverser interface {
+	// ReverseInbound converts an inbound config to the settings of Xray's JSON configuration.
+	ReverseInbound(config proto.Message) (json.RawMessage, error)
+}
+
+// outboundReverser is implemented by adapters that list outbound configs.
+type outboundReverser interface {
+	// ReverseOutbound converts an outbound config to the settings of Xray's JSON configuration.
+	ReverseOutbound(config proto.Message) (json.RawMessage, error)
+}
+
+// accountDecoder is implemented by adapters of protocols with user accounts.
+type accountDecoder interface {
+	// DecodeAccount returns the fields of an account in the form of the user request body.
+	DecodeAccount(account proto.Message) map[string]interface{}
+}
+
+// accountAdapter is implemented by adapters of protocols whose inbounds implement Xray-core's
+// proxy.UserManager, so that their users can be added and removed at runtime.
+type accountAdapter interface {
+	accountDecoder
+	// BuildAccount builds the account of a user, checking the fields the protocol requires.
+	BuildAccount(user SimplifiedUser) (proto.Message, error)
+	// SameAccount reports whether an account carries the credentials of the user. Only the
+	// fields a client authenticates with are compared, since Xray-core normalises the rest.
+	SameAccount(account proto.Message, user SimplifiedUser) bool
+}
+
+// subscriptionAdapter is implemented by adapters of protocols that subscriptions can be generated
+// for. It reads the clients of the protocol's inbounds and renders their nodes in every format;
+// the transport and security settings shared by all protocols are rendered by the formats.
+type subscriptionAdapter interface {
+	// SubscriptionClients reads the clients of an inbound from its settings.
+	SubscriptionClients(settings json.RawMessage) ([]subscriptionClient, error)
+	// ShareLink encodes a subscription node of the protocol as a share link.
+	ShareLink(node subscriptionNode) string
+	// ClashProxy sets the fields of a Clash.Meta proxy that are specific to the protocol. It
+	// reports whether the transport and TLS settings of the node apply to the proxy.
+	ClashProxy(node subscriptionNode, proxy *clashProxy) (streamSettings bool, err error)
+	// SingboxOutbound sets the fields of a sing-box outbound that are specific to the protocol.
+	// It reports whether the transport and TLS settings of the node apply to the outbound.
+	SingboxOutbound(node subscriptionNode, outbound *singboxOutbound) (streamSettings bool, err error)
+	// XrayOutboundSettings returns the settings of an Xray outbound to the node.
+	XrayOutboundSettings(node subscriptionNode) map[string]interface{}
+}
+
+// protocolRegistry holds the registered protocol adapters.
+var protocolRegistry = struct {
+	byName        map[string]protocolAdapter
+	inbounds      map[string]protocolAdapter // by inbound config type URL
+	userInbounds  map[string]protocolAdapter // by inbound config type URL
+	outbounds     map[string]protocolAdapter // by outbound config type URL
+	accounts      map[string]protocolAdapter // by account type URL
+	subscriptions map[string]protocolAdapter // by ConfigProtocol
+}{
+	byName:        make(map[string]protocolAdapter),
+	inbounds:      make(map[string]protocolAdapter),
+	userInbounds:  make(map[string]protocolAdapter),
+	outbounds:     make(map[string]protocolAdapter),
+	accounts:      make(map[string]protocolAdapter),
+	subscriptions: make(map[string]protocolAdapter),
+}
+
+// registerProtocolAdapter adds an adapter to the registry. It panics when the adapter does not
+// implement what its types call for, or claims a name or type URL that is already taken, as both
+// are programming errors.
+func registerProtocolAdapter(adapter protocolAdapter) {
+	name := adapter.Name()
+	if _, ok := protocolRegistry.byName[name]; ok {
+		panic(fmt.Sprintf("protocol adapter %s registered twice", name))
+	}
+	protocolRegistry.byName[name] = adapter
+
+	register := func(registry map[string]protocolAdapter, messages []proto.Message, implemented bool, what string) {
+		if len(messages) > 0 && !implemented {
+			panic(fmt.Sprintf("protocol adapter %s lists %s types but cannot handle them", name, what))
+		}
+		for _, message := range messages {
+			typeURL := serial.GetMessageType(message)
+			if other, ok := registry[typeURL]; ok {
+				panic(fmt.Sprintf("%s type %s claimed by protocol adapters %s and %s", what, typeURL, other.Name(), name))
+			}
+			registry[typeURL] = adapter
+		}
+	}
+
+	types := adapter.Types()
+	_, reversesInbounds := adapter.(inboundReverser)
+	_, reversesOutbounds := adapter.(outboundReverser)
+	_, managesUsers := adapter.(accountAdapter)
+	_, decodesAccounts := adapter.(accountDecoder)
+	register(protocolRegistry.inbounds, types.Inbounds, reversesInbounds, "inbound")
+	register(protocolRegistry.userInbounds, types.UserInbounds, managesUsers, "user inbound")
+	register(protocolRegistry.outbounds, types.Outbounds, reversesOutbounds, "outbound")
+	register(protocolRegistry.accounts, types.Accounts, decodesAccounts, "account")
+
+	if _, ok := adapter.(subscriptionAdapter); ok {
+		if other, ok := protocolRegistry.subscriptions[adapter.ConfigProtocol()]; ok {
+			panic(fmt.Sprintf("subscriptions of %s claimed by protocol adapters %s and %s", adapter.ConfigProtocol(), other.Name(), name))
+		}
+		protocolRegistry.subscriptions[adapter.ConfigProtocol()] = adapter
+	}
+}
+
+// inboundAdapter returns the adapter of an inbound config type.
+func inboundAdapter(typeURL string) (protocolAdapter, inboundReverser, bool) {
+	adapter, ok := protocolRegistry.inbounds[typeURL]
+	if !ok {
+		return nil, nil, false
+	}
+	return adapter, adapter.(inboundReverser), true
+}
+
+// outboundAdapter returns the adapter of an outbound config type.
+func outboundAdapter(typeURL string) (protocolAdapter, outboundReverser, bool) {
+	adapter, ok := protocolRegistry.outbounds[typeURL]
+	if !ok {
+		return nil, nil, false
+	}
+	return adapter, adapter.(outboundReverser), true
+}
+
+// userInboundAdapter returns the adapter managing the users of an inbound config type.
+func userInboundAdapter(typeURL string) (protocolAdapter, bool) {
+	adapter, ok := protocolRegistry.userInbounds[typeURL]
+	return adapter, ok
+}
+
+// accountAdapterByName returns the account adapter of the protocol users are managed under.
+func accountAdapterByName(name string) (accountAdapter, error) {
+	if adapter, ok := protocolRegistry.byName[name].(accountAdapter); ok {
+		return adapter, nil
+	}
+	return nil, fmt.Errorf("protocol %s: %w", name, errUnsupportedProtocol)
+}
+
+// accountAdapterByType returns the adapter of an account type, if its protocol manages users.
+func accountAdapterByType(typeURL string) (accountAdapter, bool) {
+	adapter, ok := protocolRegistry.accounts[typeURL].(accountAdapter)
+	return adapter, ok
+}
+
+// accountDecoderByType returns the decoder of an account type.
+func accountDecoderByType(typeURL string) (accountDecoder, bool) {
+	adapter, ok := protocolRegistry.accounts[typeURL]
+	if !ok {
+		return nil, false
+	}
+	return adapter.(accountDecoder), true
+}
+
+// subscriptionAdapterOf returns the subscription adapter of a protocol of Xray's JSON configuration.
+func subscriptionAdapterOf(configProtocol string) (subscriptionAdapter, bool) {
+	adapter, ok := protocolRegistry.subscriptions[configProtocol]
+	if !ok {
+		return nil, false
+	}
+	return adapter.(subscriptionAdapter), true
+}
+
+// subscriptionProtocols lists the inbound protocols subscriptions can be generated for.
+func subscriptionProtocols() []string {
+	protocols := make([]string, 0, len(protocolRegistry.subscriptions))
+	for protocol := range protocolRegistry.subscriptions {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	return protocols
+}
+
+// isSubscriptionProtocol reports whether subscriptions can be generated for inbounds of a protocol.
+func isSubscriptionProtocol(protocol string) bool {
+	_, ok := protocolRegistry.subscriptions[protocol]
+	return ok
+}
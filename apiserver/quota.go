@@ -0,0 +1,187 @@
+package apiserver
+
+import (
+	"context"
+	"log"
+	"time"
+
+	stats_command "github.com/xtls/xray-core/app/stats/command"
+
+	"xray-api-bridge/store"
+)
+
+// quotaPeriodMonthly renews a quota every month, counted from the start of its period.
+const quotaPeriodMonthly = "monthly"
+
+// RunQuotaEnforcer accounts user traffic every interval and suspends users over their quota,
+// until ctx is cancelled.
+func (s *APIServer) RunQuotaEnforcer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.enforceQuotas(ctx)
+		}
+	}
+}
+
+// enforceQuotas adds the traffic since the last poll to every quota, renews expired periods,
+// and suspends or resumes users accordingly.
+func (s *APIServer) enforceQuotas(ctx context.Context) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	quotas := s.store.Quotas.List()
+	if len(quotas) == 0 {
+		return
+	}
+
+	traffic, err := s.queryUserTraffic(ctx, "", false)
+	if err != nil {
+		log.Printf("Warning: quota enforcement skipped: %v", err)
+		return
+	}
+
+	// Counters start over with every Xray-core process
+	now := time.Now()
+	restarted := !s.lastQuotaPoll.IsZero() && s.xrayClient.LastRestart().After(s.lastQuotaPoll)
+	s.lastQuotaPoll = now
+
+	for i := range quotas {
+		q := &quotas[i]
+		renewQuotaPeriod(q, now)
+
+		if t, ok := traffic[q.Email]; ok {
+			addQuotaUsage(q, counterDelta(q.LastUplink, t.Uplink, restarted), counterDelta(q.LastDownlink, t.Downlink, restarted))
+			q.LastUplink, q.LastDownlink = t.Uplink, t.Downlink
+		}
+	}
+
+	if err := s.store.Quotas.Put(quotas...); err != nil {
+		log.Printf("Warning: failed to persist quota usage: %v", err)
+	}
+
+	for _, q := range quotas {
+		s.applyQuota(ctx, q)
+	}
+}
+
+// creditResetStats accounts the traffic of counters read right before they were reset, and makes
+// the next poll count them from zero. Any counters may be given; only per-user traffic counters
+// of users with a quota are credited, each direction on its own since either may be reset alone.
+// Callers hold quotaMu.
+func (s *APIServer) creditResetStats(stats []*stats_command.Stat) {
+	changed := make(map[string]store.Quota)
+	for _, stat := range stats {
+		email, direction, ok := parseUserTrafficStat(stat.GetName())
+		if !ok {
+			continue
+		}
+		q, ok := changed[email]
+		if !ok {
+			if q, ok = s.store.Quotas.Get(email); !ok {
+				continue
+			}
+		}
+		if direction == "uplink" {
+			addQuotaUsage(&q, counterDelta(q.LastUplink, stat.GetValue(), false), 0)
+			q.LastUplink = 0
+		} else {
+			addQuotaUsage(&q, 0, counterDelta(q.LastDownlink, stat.GetValue(), false))
+			q.LastDownlink = 0
+		}
+		changed[email] = q
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	quotas := make([]store.Quota, 0, len(changed))
+	for _, q := range changed {
+		quotas = append(quotas, q)
+	}
+	if err := s.store.Quotas.Put(quotas...); err != nil {
+		log.Printf("Warning: failed to persist quota usage: %v", err)
+	}
+}
+
+// applyQuota suspends a user who used up their quota, and resumes one who is back under it.
+func (s *APIServer) applyQuota(ctx context.Context, q store.Quota) {
+	if q.Used >= q.Limit {
+		if err := s.suspendUser(ctx, q.Email, suspendReasonQuota); err != nil {
+			log.Printf("Warning: failed to suspend user %s over quota: %v", q.Email, err)
+		}
+		return
+	}
+	if err := s.resumeUser(ctx, q.Email, suspendReasonQuota); err != nil {
+		log.Printf("Warning: failed to resume user %s under quota: %v", q.Email, err)
+	}
+}
+
+// counterDelta returns the traffic a counter gained since it was last read.
+// A counter lower than its last value has been reset, so all of it is new traffic.
+func counterDelta(last, current int64, restarted bool) int64 {
+	if restarted || current < last {
+		return current
+	}
+	return current - last
+}
+
+// renewQuotaPeriod starts a new period, with its usage cleared, once the current one is over.
+func renewQuotaPeriod(q *store.Quota, now time.Time) {
+	if q.Period != quotaPeriodMonthly || q.PeriodStart.IsZero() || now.Before(q.PeriodStart.AddDate(0, 1, 0)) {
+		return
+	}
+	for !now.Before(q.PeriodStart.AddDate(0, 1, 0)) {
+		q.PeriodStart = q.PeriodStart.AddDate(0, 1, 0)
+	}
+	clearQuotaUsage(q)
+}
+
+// addQuotaUsage counts traffic against a quota.
+func addQuotaUsage(q *store.Quota, uplink, downlink int64) {
+	q.UsedUplink += uplink
+	q.UsedDownlink += downlink
+	q.Used += uplink + downlink
+}
+
+// clearQuotaUsage starts the usage of a quota over.
+func clearQuotaUsage(q *store.Quota) {
+	q.Used, q.UsedUplink, q.UsedDownlink = 0, 0, 0
+}
+
+// quotaUsage returns the upload and download counted against a quota in its current period, up to
+// the counters given, which may have gained traffic since the last poll. Callers hold quotaMu.
+func (s *APIServer) quotaUsage(q store.Quota, t UserTraffic) (uplink, downlink int64) {
+	renewQuotaPeriod(&q, time.Now())
+	restarted := !s.lastQuotaPoll.IsZero() && s.xrayClient.LastRestart().After(s.lastQuotaPoll)
+	return q.UsedUplink + counterDelta(q.LastUplink, t.Uplink, restarted),
+		q.UsedDownlink + counterDelta(q.LastDownlink, t.Downlink, restarted)
+}
+
+// newUserQuotaResponse converts a stored quota into its API representation.
+func (s *APIServer) newUserQuotaResponse(q store.Quota) UserQuotaResponse {
+	resp := UserQuotaResponse{
+		Email:       q.Email,
+		Limit:       q.Limit,
+		Used:        q.Used,
+		Remaining:   q.Limit - q.Used,
+		Period:      q.Period,
+		PeriodStart: q.PeriodStart,
+	}
+	if resp.Remaining < 0 {
+		resp.Remaining = 0
+	}
+	if q.Period == quotaPeriodMonthly {
+		periodEnd := q.PeriodStart.AddDate(0, 1, 0)
+		resp.PeriodEnd = &periodEnd
+	}
+	if suspension, ok := s.store.Suspensions.Get(q.Email); ok {
+		resp.Suspended = suspension.HasReason(suspendReasonQuota)
+	}
+	return resp
+}
@@ -0,0 +1,106 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/xtls/xray-core/common/serial"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Views of GET /inbound and GET /outbound, selected with the `view` query parameter.
+const (
+	configViewDefault = ""    // reverse mapped to Xray's JSON configuration
+	configViewRaw     = "raw" // the config held by Xray-core, as protobuf JSON
+)
+
+// parseConfigView reads the `view` query parameter.
+func parseConfigView(view string) (string, error) {
+	if view != configViewDefault && view != configViewRaw {
+		return "", fmt.Errorf("Unsupported view '%s', expected '%s'", view, configViewRaw)
+	}
+	return view, nil
+}
+
+// typedMessageType is the protobuf name of serial.TypedMessage.
+var typedMessageType = (&serial.TypedMessage{}).ProtoReflect().Descriptor().FullName()
+
+// rawProtoJSON encodes a message with protojson, expanding every serial.TypedMessage in it to
+// {"type": ..., "value": ...} with the message its type URL names, so that nothing Xray-core
+// holds is lost or left as opaque bytes. A TypedMessage of an unknown type keeps its base64 value
+// alongside an error.
+func rawProtoJSON(m proto.Message) (interface{}, error) {
+	return rawMessageJSON(m.ProtoReflect())
+}
+
+func rawMessageJSON(m protoreflect.Message) (interface{}, error) {
+	if m.Descriptor().FullName() == typedMessageType {
+		return rawTypedMessageJSON(m.Interface().(*serial.TypedMessage))
+	}
+
+	data, err := protojson.Marshal(m.Interface())
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var obj map[string]interface{}
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	// protojson only writes populated fields, which are the ones Range visits
+	var rangeErr error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Message() == nil || (fd.IsMap() && fd.MapValue().Message() == nil) {
+			return true
+		}
+		key := fd.JSONName()
+		switch {
+		case fd.IsMap():
+			entries, ok := obj[key].(map[string]interface{})
+			if !ok {
+				return true
+			}
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				entries[k.String()], rangeErr = rawMessageJSON(mv.Message())
+				return rangeErr == nil
+			})
+		case fd.IsList():
+			items, _ := obj[key].([]interface{})
+			list := v.List()
+			for i := 0; i < list.Len() && i < len(items) && rangeErr == nil; i++ {
+				items[i], rangeErr = rawMessageJSON(list.Get(i).Message())
+			}
+		default:
+			obj[key], rangeErr = rawMessageJSON(v.Message())
+		}
+		return rangeErr == nil
+	})
+	if rangeErr != nil {
+		return nil, fmt.Errorf("%s: %w", m.Descriptor().FullName(), rangeErr)
+	}
+	return obj, nil
+}
+
+func rawTypedMessageJSON(tm *serial.TypedMessage) (interface{}, error) {
+	instance, err := tm.GetInstance()
+	if err != nil {
+		return map[string]interface{}{
+			"type":  tm.Type,
+			"value": tm.Value,
+			"error": err.Error(),
+		}, nil
+	}
+	value, err := rawMessageJSON(instance.ProtoReflect())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"type":  tm.Type,
+		"value": value,
+	}, nil
+}
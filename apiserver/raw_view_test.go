@@ -0,0 +1,166 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/serial"
+	core "github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/proxy/vless"
+	vless_inbound "github.com/xtls/xray-core/proxy/vless/inbound"
+	"github.com/xtls/xray-core/transport/internet/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// jsonPath returns the value at a dot-separated path of object keys and list indices.
+func jsonPath(v interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// buildTestInbound builds an inbound of Xray's JSON configuration into the config Xray-core holds.
+func buildTestInbound(t *testing.T, inbound string) *core.InboundHandlerConfig {
+	t.Helper()
+	var config conf.InboundDetourConfig
+	if err := json.Unmarshal([]byte(inbound), &config); err != nil {
+		t.Fatalf("could not decode inbound %s: %v", inbound, err)
+	}
+	built, err := config.Build()
+	if err != nil {
+		t.Fatalf("could not build inbound %s: %v", inbound, err)
+	}
+	return built
+}
+
+func TestRawProtoJSON(t *testing.T) {
+	const id = "b831381d-6324-4d53-ad4f-8cda48b30811"
+	vlessWS := buildTestInbound(t, `{
+		"tag": "vless-ws", "port": 443, "protocol": "vless",
+		"settings": {"decryption": "none", "clients": [{"id": "`+id+`", "email": "a@example.com", "level": 1}]},
+		"streamSettings": {"network": "ws", "wsSettings": {"path": "/ws", "host": "example.com"}}
+	}`)
+
+	tests := []struct {
+		name    string
+		message proto.Message
+		// want maps paths of the output to their expected values, compared as JSON
+		want map[string]string
+		// messages maps paths of expanded TypedMessage values to the messages they must decode to
+		messages map[string]proto.Message
+		// wantError is the path of the error expected next to an undecodable TypedMessage
+		wantError string
+	}{
+		{
+			name:    "inbound",
+			message: vlessWS,
+			want: map[string]string{
+				"tag":                                 `"vless-ws"`,
+				"proxySettings.type":                  strconv.Quote(serial.GetMessageType(&vless_inbound.Config{})),
+				"proxySettings.value.clients.0.email": `"a@example.com"`,
+				"proxySettings.value.clients.0.account.type":                              strconv.Quote(serial.GetMessageType(&vless.Account{})),
+				"receiverSettings.value.streamSettings.transportSettings.0.settings.type": strconv.Quote(serial.GetMessageType(&websocket.Config{})),
+			},
+			messages: map[string]proto.Message{
+				"proxySettings.value.clients.0.account.value":                              &vless.Account{Id: id},
+				"receiverSettings.value.streamSettings.transportSettings.0.settings.value": &websocket.Config{Path: "/ws", Host: "example.com"},
+			},
+		},
+		{
+			name: "typed message",
+			message: &protocol.User{
+				Email:   "b@example.com",
+				Account: serial.ToTypedMessage(&vless.Account{Id: id, Flow: "xtls-rprx-vision"}),
+			},
+			want: map[string]string{
+				"email":        `"b@example.com"`,
+				"account.type": strconv.Quote(serial.GetMessageType(&vless.Account{})),
+			},
+			messages: map[string]proto.Message{
+				"account.value": &vless.Account{Id: id, Flow: "xtls-rprx-vision"},
+			},
+		},
+		{
+			name: "unknown type",
+			message: &protocol.User{
+				Email:   "c@example.com",
+				Account: &serial.TypedMessage{Type: "xray.proxy.unknown.Account", Value: []byte{0x0a, 0x01, 0x61}},
+			},
+			want: map[string]string{
+				"account.type":  `"xray.proxy.unknown.Account"`,
+				"account.value": `"CgFh"`,
+			},
+			wantError: "account.error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := rawProtoJSON(tt.message)
+			if err != nil {
+				t.Fatalf("rawProtoJSON: %v", err)
+			}
+			// Decode the output as a client would
+			data, err := json.Marshal(raw)
+			if err != nil {
+				t.Fatalf("output does not encode: %v", err)
+			}
+			var output interface{}
+			if err := json.Unmarshal(data, &output); err != nil {
+				t.Fatalf("output %s does not decode: %v", data, err)
+			}
+
+			for path, want := range tt.want {
+				got, ok := jsonPath(output, path)
+				if !ok {
+					t.Errorf("%s is missing from %s", path, data)
+					continue
+				}
+				if gotJSON, _ := json.Marshal(got); string(gotJSON) != want {
+					t.Errorf("%s = %s, want %s", path, gotJSON, want)
+				}
+			}
+			for path, want := range tt.messages {
+				value, ok := jsonPath(output, path)
+				if !ok {
+					t.Errorf("%s is missing from %s", path, data)
+					continue
+				}
+				valueJSON, _ := json.Marshal(value)
+				got := want.ProtoReflect().New().Interface()
+				if err := protojson.Unmarshal(valueJSON, got); err != nil {
+					t.Errorf("%s = %s does not decode as %T: %v", path, valueJSON, want, err)
+					continue
+				}
+				if !proto.Equal(got, want) {
+					t.Errorf("%s decodes to %v, want %v", path, got, want)
+				}
+			}
+			if tt.wantError != "" {
+				if msg, _ := jsonPath(output, tt.wantError); msg == nil {
+					t.Errorf("%s is missing from %s", tt.wantError, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	proxyman_command "github.com/xtls/xray-core/app/proxyman/command"
+	router_command "github.com/xtls/xray-core/app/router/command"
+	"github.com/xtls/xray-core/infra/conf"
+
+	"xray-api-bridge/store"
+)
+
+// Reconcile pushes every outbound, inbound, routing rule and user managed by the bridge back into
+// Xray-core. Objects Xray-core still holds are left untouched, so it is safe to call at any time.
+func (s *APIServer) Reconcile(ctx context.Context) {
+	s.restoreOutbounds(ctx)
+	s.restoreInbounds(ctx)
+	s.restoreRules(ctx)
+	s.restoreUsers(ctx)
+	s.reapplySuspensions(ctx)
+	s.assignStoredShortIDs(ctx)
+}
+
+// isAlreadyExistsError reports whether err is Xray-core refusing to add an object that is already present.
+func isAlreadyExistsError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already exists") || strings.Contains(msg, "existing tag") || strings.Contains(msg, "duplicate")
+}
+
+// restoreOutbounds re-adds the outbounds created through the bridge.
+func (s *APIServer) restoreOutbounds(ctx context.Context) {
+	objects := s.store.Outbounds.List()
+	restored := 0
+	for _, obj := range objects {
+		var outboundConfig conf.OutboundDetourConfig
+		if err := json.Unmarshal(obj.Config, &outboundConfig); err != nil {
+			log.Printf("Warning: failed to decode stored outbound %s: %v", obj.Tag, err)
+			continue
+		}
+		outboundHandlerConfig, err := outboundConfig.Build()
+		if err != nil {
+			log.Printf("Warning: failed to build stored outbound %s: %v", obj.Tag, err)
+			continue
+		}
+		_, err = s.xrayClient.HandlerClient.AddOutbound(ctx, &proxyman_command.AddOutboundRequest{Outbound: outboundHandlerConfig})
+		if err != nil {
+			if !isAlreadyExistsError(err) {
+				log.Printf("Warning: failed to restore outbound %s: %v", obj.Tag, err)
+			}
+			continue
+		}
+		restored++
+	}
+	if len(objects) > 0 {
+		log.Printf("Restored %d of %d stored outbounds to Xray-core", restored, len(objects))
+	}
+}
+
+// restoreInbounds re-adds the inbounds created through the bridge.
+func (s *APIServer) restoreInbounds(ctx context.Context) {
+	objects := s.store.Inbounds.List()
+	restored := 0
+	for _, obj := range objects {
+		var inboundConfig conf.InboundDetourConfig
+		if err := json.Unmarshal(obj.Config, &inboundConfig); err != nil {
+			log.Printf("Warning: failed to decode stored inbound %s: %v", obj.Tag, err)
+			continue
+		}
+		inboundHandlerConfig, err := inboundConfig.Build()
+		if err != nil {
+			log.Printf("Warning: failed to build stored inbound %s: %v", obj.Tag, err)
+			continue
+		}
+		_, err = s.xrayClient.HandlerClient.AddInbound(ctx, &proxyman_command.AddInboundRequest{Inbound: inboundHandlerConfig})
+		if err != nil {
+			if !isAlreadyExistsError(err) {
+				log.Printf("Warning: failed to restore inbound %s: %v", obj.Tag, err)
+			}
+			continue
+		}
+		restored++
+	}
+	if len(objects) > 0 {
+		log.Printf("Restored %d of %d stored inbounds to Xray-core", restored, len(objects))
+	}
+}
+
+// restoreRules appends the tagged routing rules created through the bridge.
+func (s *APIServer) restoreRules(ctx context.Context) {
+	objects := s.store.Rules.List()
+	restored := 0
+	for _, obj := range objects {
+		typedConfig, err := newRuleConfig(obj.Config)
+		if err != nil {
+			log.Printf("Warning: failed to build stored routing rule %s: %v", obj.Tag, err)
+			continue
+		}
+		// Append, so the rules from Xray-core's own configuration are kept
+		_, err = s.xrayClient.RouterClient.AddRule(ctx, &router_command.AddRuleRequest{Config: typedConfig, ShouldAppend: true})
+		if err != nil {
+			if !isAlreadyExistsError(err) {
+				log.Printf("Warning: failed to restore routing rule %s: %v", obj.Tag, err)
+			}
+			continue
+		}
+		restored++
+	}
+	if len(objects) > 0 {
+		log.Printf("Restored %d of %d stored routing rules to Xray-core", restored, len(objects))
+	}
+}
+
+// restoreUsers pushes every user kept in the bridge's user store back into its inbound. Users the
+// inbound already holds are skipped rather than added again, as some inbounds, e.g. classic
+// Shadowsocks, accept duplicates instead of reporting them, and removing the user later would
+// only remove one copy.
+func (s *APIServer) restoreUsers(ctx context.Context) {
+	users := s.store.Users.List()
+	held := make(map[string]map[string]struct{}) // emails each inbound holds, by tag
+	restored, present := 0, 0
+	for _, u := range users {
+		// Suspended users are put back when their suspension is lifted
+		if s.store.Suspensions.IsSuspended(u.Email) {
+			continue
+		}
+		emails, ok := held[u.Tag]
+		if !ok {
+			emails = make(map[string]struct{})
+			// An inbound that is missing or holds no users answers with an error; adding reports it
+			if resp, err := s.xrayClient.HandlerClient.GetInboundUsers(ctx, &proxyman_command.GetInboundUserRequest{Tag: u.Tag}); err == nil {
+				for _, user := range resp.GetUsers() {
+					emails[user.Email] = struct{}{}
+				}
+			}
+			held[u.Tag] = emails
+		}
+		if _, ok := emails[u.Email]; ok {
+			present++
+			continue
+		}
+		protocolName := u.Protocol
+		if protocolName == "" {
+			protocolName = "vless"
+		}
+		if err := s.addInboundUser(ctx, u.Tag, protocolName, fromStoredUser(u)); err != nil {
+			if !isAlreadyExistsError(err) {
+				log.Printf("Warning: failed to restore user %s to inbound %s: %v", u.Email, u.Tag, err)
+			}
+			continue
+		}
+		emails[u.Email] = struct{}{}
+		restored++
+	}
+	if len(users) > 0 {
+		log.Printf("Restored %d of %d stored users to Xray-core, %d were still present", restored, len(users), present)
+	}
+}
+
+// storeObject records a configuration object added through the bridge so it can be restored later.
+func storeObject(objects *store.ObjectStore, kind, tag string, raw json.RawMessage) {
+	if err := objects.Put(tag, raw); err != nil {
+		log.Printf("Warning: failed to persist %s %s: %v", kind, tag, err)
+	}
+}
+
+// unstoreObject drops a configuration object removed through the bridge.
+func unstoreObject(objects *store.ObjectStore, kind, tag string) {
+	if err := objects.Delete(tag); err != nil {
+		log.Printf("Warning: failed to persist removal of %s %s: %v", kind, tag, err)
+	}
+}
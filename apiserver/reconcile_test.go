@@ -0,0 +1,104 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	proxyman_command "github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/common/protocol"
+	"google.golang.org/grpc"
+
+	"xray-api-bridge/store"
+	"xray-api-bridge/xrayapi"
+)
+
+// duplicatingHandlerClient is a HandlerService holding the users of its inbounds the way classic
+// Shadowsocks does: adding a user never fails, even when its email is already present, and
+// removing a user only removes the first copy.
+type duplicatingHandlerClient struct {
+	proxyman_command.HandlerServiceClient
+	users map[string][]*protocol.User // by inbound tag
+}
+
+func (c *duplicatingHandlerClient) ListInbounds(ctx context.Context, in *proxyman_command.ListInboundsRequest, opts ...grpc.CallOption) (*proxyman_command.ListInboundsResponse, error) {
+	return &proxyman_command.ListInboundsResponse{}, nil
+}
+
+func (c *duplicatingHandlerClient) GetInboundUsers(ctx context.Context, in *proxyman_command.GetInboundUserRequest, opts ...grpc.CallOption) (*proxyman_command.GetInboundUserResponse, error) {
+	users, ok := c.users[in.Tag]
+	if !ok {
+		return nil, fmt.Errorf("handler not found: %s", in.Tag)
+	}
+	return &proxyman_command.GetInboundUserResponse{Users: users}, nil
+}
+
+func (c *duplicatingHandlerClient) AlterInbound(ctx context.Context, in *proxyman_command.AlterInboundRequest, opts ...grpc.CallOption) (*proxyman_command.AlterInboundResponse, error) {
+	users, ok := c.users[in.Tag]
+	if !ok {
+		return nil, fmt.Errorf("handler not found: %s", in.Tag)
+	}
+	operation, err := in.Operation.GetInstance()
+	if err != nil {
+		return nil, err
+	}
+	switch op := operation.(type) {
+	case *proxyman_command.AddUserOperation:
+		c.users[in.Tag] = append(users, op.User)
+	case *proxyman_command.RemoveUserOperation:
+		for i, u := range users {
+			if u.Email == op.Email {
+				c.users[in.Tag] = append(users[:i:i], users[i+1:]...)
+				return &proxyman_command.AlterInboundResponse{}, nil
+			}
+		}
+		return nil, fmt.Errorf("user %s not found", op.Email)
+	}
+	return &proxyman_command.AlterInboundResponse{}, nil
+}
+
+func TestReconcileDoesNotDuplicateUsers(t *testing.T) {
+	bridgeStore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("store.Open: %v", err)
+	}
+	stored := []store.User{
+		{Tag: "ss", Email: "a@example.com", Protocol: "shadowsocks", Method: "aes-128-gcm", Password: "one"},
+		{Tag: "ss", Email: "b@example.com", Protocol: "shadowsocks", Method: "aes-256-gcm", Password: "two"},
+		{Tag: "ss", Email: "c@example.com", Protocol: "shadowsocks", Method: "aes-128-gcm", Password: "three"},
+	}
+	if err := bridgeStore.Users.Put(stored...); err != nil {
+		t.Fatalf("Users.Put: %v", err)
+	}
+
+	handler := &duplicatingHandlerClient{users: map[string][]*protocol.User{"ss": nil}}
+	s := &APIServer{xrayClient: &xrayapi.Client{HandlerClient: handler}, store: bridgeStore}
+	// c@example.com is already held, e.g. from Xray-core's own configuration
+	if err := s.addInboundUser(context.Background(), "ss", "shadowsocks", fromStoredUser(stored[2])); err != nil {
+		t.Fatalf("addInboundUser: %v", err)
+	}
+
+	// As when the bridge restarts twice while Xray-core keeps running
+	s.Reconcile(context.Background())
+	s.Reconcile(context.Background())
+
+	copies := make(map[string]int)
+	for _, u := range handler.users["ss"] {
+		copies[u.Email]++
+	}
+	for _, u := range stored {
+		if copies[u.Email] != 1 {
+			t.Errorf("inbound holds %d copies of %s, want 1", copies[u.Email], u.Email)
+		}
+	}
+
+	// Removing the user once must leave no access behind
+	if err := s.removeInboundUser(context.Background(), "ss", "a@example.com"); err != nil {
+		t.Fatalf("removeInboundUser: %v", err)
+	}
+	for _, u := range handler.users["ss"] {
+		if u.Email == "a@example.com" {
+			t.Errorf("inbound still holds a@example.com after it was removed")
+		}
+	}
+}
@@ -1,13 +1,47 @@
 package apiserver
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
-// SimplifiedUser defines a simplified, flat user structure for VLESS user configuration.
+// SimplifiedUser defines a simplified, flat user structure for inbound user configuration.
+// Which fields are required depends on the protocol of the target inbound.
 type SimplifiedUser struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Flow  string `json:"flow,omitempty"`
-	Level uint32 `json:"level,omitempty"`
+	ID       string `json:"id,omitempty"` // vless, vmess
+	Email    string `json:"email"`
+	Flow     string `json:"flow,omitempty"` // vless
+	Level    uint32 `json:"level,omitempty"`
+	Security string `json:"security,omitempty"` // vmess
+	Password string `json:"password,omitempty"` // trojan, shadowsocks, shadowsocks-2022
+	Method   string `json:"method,omitempty"`   // shadowsocks
+	// ExpireAt, when set, suspends the user from every inbound once the date has passed.
+	ExpireAt *time.Time `json:"expireAt,omitempty"`
+}
+
+// UserQuotaRequest defines the request body for setting the traffic quota of a user.
+type UserQuotaRequest struct {
+	Limit      int64  `json:"limit"`                // bytes, uplink and downlink combined
+	Period     string `json:"period,omitempty"`     // "monthly", or empty for a one-off quota
+	ResetUsage bool   `json:"resetUsage,omitempty"` // start a new period with no usage
+}
+
+// UserExpiryRequest defines the request body for setting or renewing the expiry date of a user.
+type UserExpiryRequest struct {
+	ExpireAt time.Time `json:"expireAt"`
+}
+
+// DeviceLimitRequest defines the request body for setting the device limit of a user.
+type DeviceLimitRequest struct {
+	MaxIPs   int    `json:"maxIPs"`             // simultaneous source IPs allowed
+	Action   string `json:"action,omitempty"`   // "log" (default), "webhook", "kick" or "block"
+	Duration string `json:"duration,omitempty"` // how long a kick or a block lasts, e.g. "5m"
+}
+
+// ShortIDRequest defines the request body for reassigning the REALITY shortId of a user.
+type ShortIDRequest struct {
+	Tag     string `json:"tag"`               // the REALITY inbound
+	ShortID string `json:"shortId,omitempty"` // one of the inbound's shortIds, or empty for the least used other one
 }
 
 // SubscriptionProfile defines the structure for a single subscription generation profile.
@@ -19,17 +53,21 @@ type SubscriptionProfile struct {
 	Protocol      string          `json:"protocol"`
 	Network       string          `json:"network"`
 	Security      string          `json:"security"`
-	Description   string          `json:"description"`
-	Encryption    string          `json:"encryption"`
-	Fingerprint   string          `json:"fingerprint"`
-	ServerName    string          `json:"serverName"`
-	Flow          string          `json_"flow"`
-	Password      string          `json:"password"`
-	Mldsa65Verify string          `json:"mldsa65Verify"`
-	Alpn          []string        `json:"alpn"`
-	EchConfigList string          `json:"echConfigList"`
-	Host          string          `json:"host"`
-	Mode          string          `json:"mode"`
-	Extra         json.RawMessage `json:"extra"`
-	Path          string          `json:"path"`
+	Description   string          `json:"description,omitempty"`
+	Encryption    string          `json:"encryption,omitempty"`
+	Fingerprint   string          `json:"fingerprint,omitempty"`
+	ServerName    string          `json:"serverName,omitempty"`
+	Flow          string          `json:"flow,omitempty"`
+	Password      string          `json:"password,omitempty"`
+	Mldsa65Verify string          `json:"mldsa65Verify,omitempty"`
+	Alpn          []string        `json:"alpn,omitempty"`
+	EchConfigList string          `json:"echConfigList,omitempty"`
+	Host          string          `json:"host,omitempty"`
+	Mode          string          `json:"mode,omitempty"`
+	Extra         json.RawMessage `json:"extra,omitempty"`
+	Path          string          `json:"path,omitempty"`
+	LinkStyle     string          `json:"linkStyle,omitempty"` // vmess: "" for the standard base64 JSON link, "url" for vmess://uuid@host:port?...
+	// InboundTag pins the profile to one inbound, for its clients and settings, instead of the
+	// first inbound of its protocol and network.
+	InboundTag string `json:"inboundTag,omitempty"`
 }
\ No newline at end of file
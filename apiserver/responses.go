@@ -4,27 +4,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/xtls/xray-core/common/serial"
 	"github.com/xtls/xray-core/proxy/vless/inbound"
-	"github.com/xtls/xray-core/proxy/vless"
 	proxyman "github.com/xtls/xray-core/app/proxyman"
 	"github.com/xtls/xray-core/transport/internet"
 	"github.com/xtls/xray-core/transport/internet/reality"
 	"github.com/xtls/xray-core/transport/internet/splithttp"
+
+	"xray-api-bridge/store"
 )
 
 // JSONSuccessResponse defines the structure for a successful API response.
+// Warnings lists the items a listing had to leave out.
 type JSONSuccessResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Message string      `json:"message,omitempty"`
+	Success  bool          `json:"success"`
+	Data     interface{}   `json:"data,omitempty"`
+	Message  string        `json:"message,omitempty"`
+	Warnings []ItemWarning `json:"warnings,omitempty"`
+}
+
+// ItemWarning describes an item of a listing that could not be returned.
+type ItemWarning struct {
+	Tag     string `json:"tag"`
+	Warning string `json:"warning"`
 }
 
 // JSONErrorResponse defines the structure for an error API response.
+// Data carries what was done before the error, for requests that stop part way.
 type JSONErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
+	Success bool        `json:"success"`
+	Error   string      `json:"error"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
 // RespondWithJSON writes a JSON response with a given status code and payload.
@@ -43,6 +55,33 @@ func RespondWithError(w http.ResponseWriter, statusCode int, errorMessage string
 	RespondWithJSON(w, statusCode, payload)
 }
 
+// RespondWithErrorData writes a JSON error response along with the data of what was done
+// before the error.
+func RespondWithErrorData(w http.ResponseWriter, statusCode int, errorMessage string, data interface{}) {
+	RespondWithJSON(w, statusCode, JSONErrorResponse{
+		Success: false,
+		Error:   errorMessage,
+		Data:    data,
+	})
+}
+
+// RespondWithBatchResults writes the per-user results of a best-effort batch.
+// The status is 200 when every operation succeeded and 207 (Multi-Status) otherwise.
+func RespondWithBatchResults(w http.ResponseWriter, results []UserOperationResult, message string) {
+	failed := 0
+	for _, result := range results {
+		if result.Status != "ok" {
+			failed++
+		}
+	}
+
+	statusCode := http.StatusOK
+	if failed > 0 {
+		statusCode = http.StatusMultiStatus
+	}
+	RespondWithJSON(w, statusCode, JSONSuccessResponse{Success: failed == 0, Data: results, Message: message})
+}
+
 // SimplifiedInboundResponse defines a user-friendly JSON structure for an inbound handler.
 type SimplifiedInboundResponse struct {
 	Tag              string      `json:"tag"`
@@ -57,6 +96,133 @@ type SimplifiedOutboundResponse struct {
 	ProxySettings  interface{} `json:"proxy_settings,omitempty"`
 }
 
+// InboundUsersDiff describes the changes applied to bring an inbound to its desired list of users.
+type InboundUsersDiff struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Updated   []string `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+	// Suspended lists desired users left out of the inbound until their suspension is lifted.
+	Suspended []string `json:"suspended,omitempty"`
+	DryRun    bool     `json:"dryRun,omitempty"`
+}
+
+// UserOperationResult reports the outcome of a single user operation in a best-effort batch.
+type UserOperationResult struct {
+	Email  string `json:"email"`
+	Status string `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UserTraffic is the traffic of a single user as counted by Xray-core, in bytes.
+type UserTraffic struct {
+	Email    string `json:"email"`
+	Uplink   int64  `json:"uplink"`
+	Downlink int64  `json:"downlink"`
+	Total    int64  `json:"total"`
+}
+
+// OnlineUser describes a user currently connected to Xray-core and the source IPs in use.
+type OnlineUser struct {
+	Email string     `json:"email"`
+	IPs   []OnlineIP `json:"ips"`
+}
+
+// OnlineIP is a source IP of an online user and when it was last seen.
+type OnlineIP struct {
+	IP       string    `json:"ip"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// StatsHistoryResponse holds the traffic of a counter over time, one point per step.
+type StatsHistoryResponse struct {
+	Name   string               `json:"name"`
+	Step   string               `json:"step"`
+	From   time.Time            `json:"from"`
+	To     time.Time            `json:"to"`
+	Total  int64                `json:"total"`
+	Points []store.HistoryPoint `json:"points"`
+}
+
+// UserQuotaResponse describes the traffic quota of a user and how much of it is used.
+type UserQuotaResponse struct {
+	Email       string     `json:"email"`
+	Limit       int64      `json:"limit"`
+	Used        int64      `json:"used"`
+	Remaining   int64      `json:"remaining"`
+	Period      string     `json:"period,omitempty"`
+	PeriodStart time.Time  `json:"periodStart"`
+	PeriodEnd   *time.Time `json:"periodEnd,omitempty"`
+	Suspended   bool       `json:"suspended"`
+}
+
+// UserExpiryResponse describes the expiry date of a user.
+type UserExpiryResponse struct {
+	Email     string     `json:"email"`
+	ExpireAt  time.Time  `json:"expireAt"`
+	Expired   bool       `json:"expired"`
+	ExpiredAt *time.Time `json:"expiredAt,omitempty"`
+}
+
+// SubscriptionTokenResponse describes the subscription token of a user.
+type SubscriptionTokenResponse struct {
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"` // path of the subscription, relative to the bridge
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SubscriptionProfileResponse is a subscription profile along with its position in the file,
+// which identifies it in the profile API.
+type SubscriptionProfileResponse struct {
+	Index int `json:"index"`
+	SubscriptionProfile
+	// Error is why a profile loaded from the file fails validation and is left out of subscriptions.
+	Error string `json:"error,omitempty"`
+}
+
+// ShortIDResponse is the REALITY shortId assigned to a user on a REALITY inbound.
+type ShortIDResponse struct {
+	Tag        string    `json:"tag"`
+	Email      string    `json:"email"`
+	ShortID    string    `json:"shortId"`
+	AssignedAt time.Time `json:"assignedAt"`
+}
+
+// DeviceLimitResponse describes the device limit of a user and the actions currently in force.
+type DeviceLimitResponse struct {
+	Email       string              `json:"email"`
+	MaxIPs      int                 `json:"maxIPs"`
+	Action      string              `json:"action"`
+	Duration    string              `json:"duration"`
+	KickedUntil *time.Time          `json:"kickedUntil,omitempty"`
+	BlockedIPs  []BlockedIPResponse `json:"blockedIPs"`
+}
+
+// BlockedIPResponse is a source IP blocked for going over a device limit.
+type BlockedIPResponse struct {
+	IP    string    `json:"ip"`
+	Until time.Time `json:"until"`
+}
+
+// DeviceLimitEvent is posted to the device limit webhook when a user goes over the limit.
+type DeviceLimitEvent struct {
+	Event  string     `json:"event"`
+	Email  string     `json:"email"`
+	MaxIPs int        `json:"maxIPs"`
+	IPs    []OnlineIP `json:"ips"`
+	Time   time.Time  `json:"time"`
+}
+
+// SuspendedUserResponse describes a user taken out of every inbound by the bridge.
+type SuspendedUserResponse struct {
+	Email       string    `json:"email"`
+	Reasons     []string  `json:"reasons"`
+	SuspendedAt time.Time `json:"suspendedAt"`
+	Inbounds    []string  `json:"inbounds"`
+}
+
 // JSONVlessUser is a struct for marshaling VLESS user info into a more readable JSON format.
 type JSONVlessUser struct {
 	Level   uint32      `json:"level"`
@@ -99,12 +265,12 @@ func DecodeTypedMessage(msg *serial.TypedMessage) (interface{}, error) {
 			}, nil
 		}
 		return result, nil
-	case *vless.Account:
-		return map[string]interface{}{
-			"id":   v.Id,
-			"flow": v.Flow,
-		}, nil
 	default:
+		// Accounts are decoded by the adapter of their protocol
+		if decoder, ok := accountDecoderByType(msg.Type); ok {
+			return decoder.DecodeAccount(v), nil
+		}
+
 		// 对于其他类型，尝试 JSON 序列化以获得更好的可读性
 		jsonBytes, err := json.Marshal(instance)
 		if err != nil {
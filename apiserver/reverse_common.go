@@ -9,10 +9,14 @@ import (
 	"github.com/xtls/xray-core/app/proxyman"
 	"github.com/xtls/xray-core/infra/conf"
 	"github.com/xtls/xray-core/transport/internet"
+	"github.com/xtls/xray-core/transport/internet/grpc"
+	"github.com/xtls/xray-core/transport/internet/httpupgrade"
+	"github.com/xtls/xray-core/transport/internet/kcp"
 	"github.com/xtls/xray-core/transport/internet/reality"
 	"github.com/xtls/xray-core/transport/internet/splithttp"
 	"github.com/xtls/xray-core/transport/internet/tcp"
 	"github.com/xtls/xray-core/transport/internet/tls"
+	"github.com/xtls/xray-core/transport/internet/websocket"
 )
 
 // ReverseProxySettings converts *internet.ProxyConfig to *conf.ProxyConfig
@@ -64,15 +68,7 @@ func ReverseStreamSettings(s *internet.StreamConfig) *conf.StreamConfig {
 	}
 
 	// Reverse mapping for network protocol names
-	var protocolName string
-	switch s.ProtocolName {
-	case "tcp":
-		protocolName = "raw"
-	case "splithttp":
-		protocolName = "xhttp"
-	default:
-		protocolName = s.ProtocolName
-	}
+	protocolName := reverseTransportProtocolName(s.ProtocolName)
 	protocol := conf.TransportProtocol(protocolName)
 
 	// Reverse mapping for security types
@@ -103,11 +99,23 @@ func ReverseStreamSettings(s *internet.StreamConfig) *conf.StreamConfig {
 		switch ts.ProtocolName {
 		case "tcp":
 			if config, ok := instance.(*tcp.Config); ok {
-				cs.RAWSettings = &conf.TCPConfig{
-					AcceptProxyProtocol: config.AcceptProxyProtocol,
-					// HeaderConfig is not directly available in internet.TCPConfig, it's built from HeaderSettings
-					// For now, we'll leave it as default or try to reverse map if needed later.
-				}
+				cs.RAWSettings = ReverseTCPSettings(config)
+			}
+		case "websocket":
+			if config, ok := instance.(*websocket.Config); ok {
+				cs.WSSettings = ReverseWebSocketSettings(config)
+			}
+		case "httpupgrade":
+			if config, ok := instance.(*httpupgrade.Config); ok {
+				cs.HTTPUPGRADESettings = ReverseHTTPUpgradeSettings(config)
+			}
+		case "grpc":
+			if config, ok := instance.(*grpc.Config); ok {
+				cs.GRPCSettings = ReverseGRPCSettings(config)
+			}
+		case "mkcp":
+			if config, ok := instance.(*kcp.Config); ok {
+				cs.KCPSettings = ReverseKCPSettings(config)
 			}
 		case "splithttp":
 			if config, ok := instance.(*splithttp.Config); ok {
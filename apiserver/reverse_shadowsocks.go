@@ -0,0 +1,172 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/proxy/shadowsocks"
+	"github.com/xtls/xray-core/proxy/shadowsocks_2022"
+)
+
+// shadowsocksCipherNames maps the Shadowsocks cipher types to the method names used in Xray's JSON configuration.
+var shadowsocksCipherNames = map[shadowsocks.CipherType]string{
+	shadowsocks.CipherType_AES_128_GCM:        "aes-128-gcm",
+	shadowsocks.CipherType_AES_256_GCM:        "aes-256-gcm",
+	shadowsocks.CipherType_CHACHA20_POLY1305:  "chacha20-ietf-poly1305",
+	shadowsocks.CipherType_XCHACHA20_POLY1305: "xchacha20-ietf-poly1305",
+	shadowsocks.CipherType_NONE:               "none",
+}
+
+// ShadowsocksUserConfig is a user-facing struct for a Shadowsocks user.
+// Shadowsocks 2022 users have no method of their own, their password is their key.
+// Address and Port are only set for the destinations of a Shadowsocks 2022 relay.
+type ShadowsocksUserConfig struct {
+	Method   string        `json:"method,omitempty"`
+	Password string        `json:"password"`
+	Level    uint32        `json:"level"`
+	Email    string        `json:"email"`
+	Address  *conf.Address `json:"address,omitempty"`
+	Port     uint16        `json:"port,omitempty"`
+}
+
+// ShadowsocksInboundConfig is a user-facing struct for Shadowsocks inbound settings.
+// Method and Password are only set for Shadowsocks 2022, where Password is the server key.
+type ShadowsocksInboundConfig struct {
+	Method   string                   `json:"method,omitempty"`
+	Password string                   `json:"password,omitempty"`
+	Level    int32                    `json:"level,omitempty"`
+	Email    string                   `json:"email,omitempty"`
+	Clients  []*ShadowsocksUserConfig `json:"clients,omitempty"`
+	Network  string                   `json:"network,omitempty"`
+	IVCheck  bool                     `json:"ivCheck,omitempty"`
+}
+
+// ReverseShadowsocksInbound converts a shadowsocks.ServerConfig to a conf.ShadowsocksServerConfig's settings
+func ReverseShadowsocksInbound(config *shadowsocks.ServerConfig) (json.RawMessage, error) {
+	settings := &ShadowsocksInboundConfig{
+		Network: reverseNetworkList(config.Network),
+	}
+	for _, u := range config.Users {
+		instance, err := u.Account.GetInstance()
+		if err != nil {
+			return nil, err
+		}
+		ssAccount := instance.(*shadowsocks.Account)
+		settings.Clients = append(settings.Clients, &ShadowsocksUserConfig{
+			Method:   shadowsocksCipherNames[ssAccount.CipherType],
+			Password: ssAccount.Password,
+			Level:    u.Level,
+			Email:    u.Email,
+		})
+		settings.IVCheck = settings.IVCheck || ssAccount.IvCheck
+	}
+
+	return json.Marshal(settings)
+}
+
+// ReverseShadowsocks2022Inbound converts a single-user shadowsocks_2022.ServerConfig to a conf.ShadowsocksServerConfig's settings
+func ReverseShadowsocks2022Inbound(config *shadowsocks_2022.ServerConfig) (json.RawMessage, error) {
+	settings := &ShadowsocksInboundConfig{
+		Method:   config.Method,
+		Password: config.Key,
+		Level:    config.Level,
+		Email:    config.Email,
+		Network:  reverseNetworkList(config.Network),
+	}
+	return json.Marshal(settings)
+}
+
+// ReverseShadowsocks2022MultiUserInbound converts a shadowsocks_2022.MultiUserServerConfig to a conf.ShadowsocksServerConfig's settings
+func ReverseShadowsocks2022MultiUserInbound(config *shadowsocks_2022.MultiUserServerConfig) (json.RawMessage, error) {
+	settings := &ShadowsocksInboundConfig{
+		Method:   config.Method,
+		Password: config.Key,
+		Network:  reverseNetworkList(config.Network),
+	}
+	for _, u := range config.Users {
+		instance, err := u.Account.GetInstance()
+		if err != nil {
+			return nil, err
+		}
+		ssAccount := instance.(*shadowsocks_2022.Account)
+		settings.Clients = append(settings.Clients, &ShadowsocksUserConfig{
+			Password: ssAccount.Key,
+			Level:    u.Level,
+			Email:    u.Email,
+		})
+	}
+
+	return json.Marshal(settings)
+}
+
+// ReverseShadowsocks2022RelayInbound converts a shadowsocks_2022.RelayServerConfig to a conf.ShadowsocksServerConfig's settings
+func ReverseShadowsocks2022RelayInbound(config *shadowsocks_2022.RelayServerConfig) (json.RawMessage, error) {
+	settings := &ShadowsocksInboundConfig{
+		Method:   config.Method,
+		Password: config.Key,
+		Network:  reverseNetworkList(config.Network),
+	}
+	for _, d := range config.Destinations {
+		user := &ShadowsocksUserConfig{
+			Password: d.Key,
+			Level:    uint32(d.Level),
+			Email:    d.Email,
+			Port:     uint16(d.Port),
+		}
+		if d.Address != nil {
+			user.Address = &conf.Address{Address: d.Address.AsAddress()}
+		}
+		settings.Clients = append(settings.Clients, user)
+	}
+
+	return json.Marshal(settings)
+}
+
+// ReverseShadowsocksOutbound converts a shadowsocks.ClientConfig to a conf.ShadowsocksClientConfig's settings
+func ReverseShadowsocksOutbound(config *shadowsocks.ClientConfig) (json.RawMessage, error) {
+	settings := &conf.ShadowsocksClientConfig{}
+	if config.Server != nil {
+		settings.Address, settings.Port = reverseServerAddress(config.Server)
+		if u := config.Server.User; u != nil {
+			instance, err := u.Account.GetInstance()
+			if err != nil {
+				return nil, err
+			}
+			ssAccount := instance.(*shadowsocks.Account)
+			settings.Cipher = shadowsocksCipherNames[ssAccount.CipherType]
+			settings.Password = ssAccount.Password
+			settings.IVCheck = ssAccount.IvCheck
+			settings.Level = byte(u.Level)
+			settings.Email = u.Email
+		}
+	}
+
+	return json.Marshal(settings)
+}
+
+// ReverseShadowsocks2022Outbound converts a shadowsocks_2022.ClientConfig to a conf.ShadowsocksClientConfig's settings
+func ReverseShadowsocks2022Outbound(config *shadowsocks_2022.ClientConfig) (json.RawMessage, error) {
+	settings := &conf.ShadowsocksClientConfig{
+		Port:       uint16(config.Port),
+		Cipher:     config.Method,
+		Password:   config.Key,
+		UoT:        config.UdpOverTcp,
+		UoTVersion: int(config.UdpOverTcpVersion),
+	}
+	if config.Address != nil {
+		settings.Address = &conf.Address{Address: config.Address.AsAddress()}
+	}
+
+	return json.Marshal(settings)
+}
+
+// reverseNetworkList converts a list of networks to the comma-separated form of Xray's JSON configuration.
+func reverseNetworkList(networks []net.Network) string {
+	names := make([]string, 0, len(networks))
+	for _, n := range networks {
+		names = append(names, n.SystemString())
+	}
+	return strings.Join(names, ",")
+}
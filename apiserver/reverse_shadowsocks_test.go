@@ -0,0 +1,76 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/proxy/shadowsocks_2022"
+	"google.golang.org/protobuf/proto"
+)
+
+// buildShadowsocksInbound builds inbound settings of Xray's JSON configuration into their config message.
+func buildShadowsocksInbound(t *testing.T, settings []byte) proto.Message {
+	t.Helper()
+	var config conf.ShadowsocksServerConfig
+	if err := json.Unmarshal(settings, &config); err != nil {
+		t.Fatalf("could not decode settings %s: %v", settings, err)
+	}
+	message, err := config.Build()
+	if err != nil {
+		t.Fatalf("could not build settings %s: %v", settings, err)
+	}
+	return message
+}
+
+func TestReverseShadowsocks2022MultiUserInbound(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+	}{
+		{
+			name: "aes-128-gcm",
+			settings: `{"method": "2022-blake3-aes-128-gcm", "password": "Ni+ZvK8B/2lbKW6zWy8CpQ==", "clients": [
+				{"password": "J2X1hNtYjcs2oiVdPHQu0w==", "email": "a@example.com", "level": 1},
+				{"password": "oXx2+bWDr7ED/Z3B4RBbRw==", "email": "b@example.com"}
+			]}`,
+		},
+		{
+			name: "aes-256-gcm over tcp",
+			settings: `{"method": "2022-blake3-aes-256-gcm", "password": "tHmmLaOF+cEO1lMNR0vmTQ7Ndy/9ZPxm2BPpj9NhEQs=", "network": "tcp", "clients": [
+				{"password": "W2fLpAZbl5AlE/QQcOp6yCjqs3/i9nCgTBBSxDg3gYk=", "email": "a@example.com"}
+			]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			built, ok := buildShadowsocksInbound(t, []byte(tt.settings)).(*shadowsocks_2022.MultiUserServerConfig)
+			if !ok {
+				t.Fatalf("settings do not build into a multi-user server config")
+			}
+
+			reversed, err := ReverseShadowsocks2022MultiUserInbound(built)
+			if err != nil {
+				t.Fatalf("ReverseShadowsocks2022MultiUserInbound: %v", err)
+			}
+			var settings ShadowsocksInboundConfig
+			if err := json.Unmarshal(reversed, &settings); err != nil {
+				t.Fatalf("reversed settings %s do not decode: %v", reversed, err)
+			}
+			if settings.Method != built.Method || settings.Password != built.Key {
+				t.Errorf("server method and key = %q, %q, want %q, %q", settings.Method, settings.Password, built.Method, built.Key)
+			}
+			for i, client := range settings.Clients {
+				if client.Method != "" {
+					t.Errorf("client %d has method %q, Shadowsocks 2022 users have none", i, client.Method)
+				}
+			}
+
+			rebuilt := buildShadowsocksInbound(t, reversed)
+			if !proto.Equal(rebuilt, built) {
+				t.Errorf("reversed settings build into %v, want %v", rebuilt, built)
+			}
+		})
+	}
+}
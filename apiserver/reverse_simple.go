@@ -1,19 +1,42 @@
 package apiserver
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	gonet "net"
+	"sort"
+	"strconv"
 
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/protocol"
 	"github.com/xtls/xray-core/infra/conf"
 	"github.com/xtls/xray-core/proxy/blackhole"
-	"github.com/xtls/xray-core/proxy/dokodemo"
 	"github.com/xtls/xray-core/proxy/dns"
+	"github.com/xtls/xray-core/proxy/dokodemo"
 	"github.com/xtls/xray-core/proxy/freedom"
 	"github.com/xtls/xray-core/proxy/http"
 	"github.com/xtls/xray-core/proxy/loopback"
 	"github.com/xtls/xray-core/proxy/socks"
 	"github.com/xtls/xray-core/proxy/wireguard"
+	"github.com/xtls/xray-core/transport/internet"
 )
 
+// domainStrategyNames maps the domain strategies to the names used in Xray's JSON configuration.
+var domainStrategyNames = map[internet.DomainStrategy]string{
+	internet.DomainStrategy_AS_IS:      "AsIs",
+	internet.DomainStrategy_USE_IP:     "UseIP",
+	internet.DomainStrategy_USE_IP4:    "UseIPv4",
+	internet.DomainStrategy_USE_IP6:    "UseIPv6",
+	internet.DomainStrategy_USE_IP46:   "UseIPv4v6",
+	internet.DomainStrategy_USE_IP64:   "UseIPv6v4",
+	internet.DomainStrategy_FORCE_IP:   "ForceIP",
+	internet.DomainStrategy_FORCE_IP4:  "ForceIPv4",
+	internet.DomainStrategy_FORCE_IP6:  "ForceIPv6",
+	internet.DomainStrategy_FORCE_IP46: "ForceIPv4v6",
+	internet.DomainStrategy_FORCE_IP64: "ForceIPv6v4",
+}
+
 // ReverseWireguardInbound reverse-maps a wireguard.DeviceConfig to a conf.WireGuardConfig
 func ReverseWireguardInbound(config *wireguard.DeviceConfig) (json.RawMessage, error) {
 	peers := make([]*conf.WireGuardPeerConfig, len(config.Peers))
@@ -54,47 +77,211 @@ func ReverseDokodemoInbound(config *dokodemo.Config) (json.RawMessage, error) {
 	return json.Marshal(dkConfig)
 }
 
-// ReverseHTTPInbound reverse-maps a http.ServerConfig to a conf.HTTPConfig
+// ReverseHTTPInbound reverse-maps a http.ServerConfig to a conf.HTTPServerConfig
 func ReverseHTTPInbound(config *http.ServerConfig) (json.RawMessage, error) {
-	return json.Marshal(config)
+	httpConfig := &conf.HTTPServerConfig{
+		Transparent: config.AllowTransparent,
+		UserLevel:   config.UserLevel,
+	}
+	for _, username := range sortedKeys(config.Accounts) {
+		httpConfig.Accounts = append(httpConfig.Accounts, &conf.HTTPAccount{
+			Username: username,
+			Password: config.Accounts[username],
+		})
+	}
+	return json.Marshal(httpConfig)
 }
 
-// ReverseSocksInbound reverse-maps a socks.ServerConfig to a conf.SocksConfig
+// ReverseSocksInbound reverse-maps a socks.ServerConfig to a conf.SocksServerConfig
 func ReverseSocksInbound(config *socks.ServerConfig) (json.RawMessage, error) {
-	return json.Marshal(config)
+	socksConfig := &conf.SocksServerConfig{
+		AuthMethod: conf.AuthMethodNoAuth,
+		UDP:        config.UdpEnabled,
+		UserLevel:  config.UserLevel,
+	}
+	if config.AuthType == socks.AuthType_PASSWORD {
+		socksConfig.AuthMethod = conf.AuthMethodUserPass
+	}
+	for _, username := range sortedKeys(config.Accounts) {
+		socksConfig.Accounts = append(socksConfig.Accounts, &conf.SocksAccount{
+			Username: username,
+			Password: config.Accounts[username],
+		})
+	}
+	if config.Address != nil {
+		socksConfig.Host = &conf.Address{Address: config.Address.AsAddress()}
+	}
+	return json.Marshal(socksConfig)
 }
 
 // ReverseDNSOutbound reverse-maps a dns.Config to a conf.DNSOutboundConfig
 func ReverseDNSOutbound(config *dns.Config) (json.RawMessage, error) {
-	return json.Marshal(config)
+	dnsConfig := &conf.DNSOutboundConfig{
+		UserLevel:  config.UserLevel,
+		NonIPQuery: config.Non_IPQuery,
+		BlockTypes: config.BlockTypes,
+	}
+	if s := config.Server; s != nil {
+		if s.Network != net.Network_Unknown {
+			dnsConfig.Network = conf.Network(s.Network.SystemString())
+		}
+		if s.Address != nil {
+			dnsConfig.Address = &conf.Address{Address: s.Address.AsAddress()}
+		}
+		dnsConfig.Port = uint16(s.Port)
+	}
+	return json.Marshal(dnsConfig)
 }
 
 // ReverseBlackholeOutbound reverse-maps a blackhole.Config to a conf.BlackholeConfig
 func ReverseBlackholeOutbound(config *blackhole.Config) (json.RawMessage, error) {
-	return json.Marshal(config)
+	blackholeConfig := &conf.BlackholeConfig{}
+	if config.Response != nil {
+		instance, err := config.Response.GetInstance()
+		if err != nil {
+			return nil, err
+		}
+		switch instance.(type) {
+		case *blackhole.HTTPResponse:
+			blackholeConfig.Response = json.RawMessage(`{"type":"http"}`)
+		case *blackhole.NoneResponse:
+			blackholeConfig.Response = json.RawMessage(`{"type":"none"}`)
+		}
+	}
+	return json.Marshal(blackholeConfig)
 }
 
 // ReverseFreedomOutbound reverse-maps a freedom.Config to a conf.FreedomConfig
 func ReverseFreedomOutbound(config *freedom.Config) (json.RawMessage, error) {
-	return json.Marshal(config)
+	freedomConfig := &conf.FreedomConfig{
+		DomainStrategy: domainStrategyNames[config.DomainStrategy],
+		UserLevel:      config.UserLevel,
+		ProxyProtocol:  config.ProxyProtocol,
+	}
+	if o := config.DestinationOverride; o != nil && o.Server != nil {
+		host := ""
+		if o.Server.Address != nil {
+			host = o.Server.Address.AsAddress().String()
+		}
+		freedomConfig.Redirect = gonet.JoinHostPort(host, strconv.Itoa(int(o.Server.Port)))
+	}
+	if f := config.Fragment; f != nil {
+		fragment := &conf.Fragment{
+			Length:   int32Range(f.LengthMin, f.LengthMax),
+			Interval: int32Range(f.IntervalMin, f.IntervalMax),
+		}
+		switch {
+		case f.PacketsFrom == 0 && f.PacketsTo == 1:
+			fragment.Packets = "tlshello"
+		case f.PacketsFrom == 0 && f.PacketsTo == 0:
+			fragment.Packets = ""
+		default:
+			fragment.Packets = int32Range(f.PacketsFrom, f.PacketsTo).String()
+		}
+		if f.MaxSplitMin != 0 || f.MaxSplitMax != 0 {
+			fragment.MaxSplit = int32Range(f.MaxSplitMin, f.MaxSplitMax)
+		}
+		freedomConfig.Fragment = fragment
+	}
+	for _, n := range config.Noises {
+		noise := &conf.Noise{ApplyTo: n.ApplyTo}
+		if len(n.Packet) > 0 {
+			// The packet is kept as bytes, whatever type it was configured with
+			noise.Type = "base64"
+			noise.Packet = base64.StdEncoding.EncodeToString(n.Packet)
+		} else {
+			noise.Type = "rand"
+			noise.Packet = int32Range(n.LengthMin, n.LengthMax).String()
+		}
+		if n.DelayMin != 0 || n.DelayMax != 0 {
+			noise.Delay = int32Range(n.DelayMin, n.DelayMax)
+		}
+		freedomConfig.Noises = append(freedomConfig.Noises, noise)
+	}
+	return json.Marshal(freedomConfig)
 }
 
 // ReverseLoopbackOutbound reverse-maps a loopback.Config to a conf.LoopbackConfig
 func ReverseLoopbackOutbound(config *loopback.Config) (json.RawMessage, error) {
-	return json.Marshal(config)
+	return json.Marshal(&conf.LoopbackConfig{InboundTag: config.InboundTag})
 }
 
-// ReverseHTTPOutbound reverse-maps a http.ClientConfig to a conf.HTTPOutboundConfig
+// ReverseHTTPOutbound reverse-maps a http.ClientConfig to a conf.HTTPClientConfig
 func ReverseHTTPOutbound(config *http.ClientConfig) (json.RawMessage, error) {
-	return json.Marshal(config)
+	httpConfig := &conf.HTTPClientConfig{}
+	if config.Server != nil {
+		httpConfig.Address, httpConfig.Port = reverseServerAddress(config.Server)
+		if u := config.Server.User; u != nil {
+			httpConfig.Level, httpConfig.Email = u.Level, u.Email
+			if u.Account != nil {
+				instance, err := u.Account.GetInstance()
+				if err != nil {
+					return nil, err
+				}
+				account, ok := instance.(*http.Account)
+				if !ok {
+					return nil, fmt.Errorf("unexpected http account type %s", u.Account.Type)
+				}
+				httpConfig.Username, httpConfig.Password = account.Username, account.Password
+			}
+		}
+	}
+	if len(config.Header) > 0 {
+		httpConfig.Headers = make(map[string]string, len(config.Header))
+		for _, h := range config.Header {
+			httpConfig.Headers[h.Key] = h.Value
+		}
+	}
+	return json.Marshal(httpConfig)
 }
 
-// ReverseSocksOutbound reverse-maps a socks.ClientConfig to a conf.SocksOutboundConfig
+// ReverseSocksOutbound reverse-maps a socks.ClientConfig to a conf.SocksClientConfig
 func ReverseSocksOutbound(config *socks.ClientConfig) (json.RawMessage, error) {
-	return json.Marshal(config)
+	socksConfig := &conf.SocksClientConfig{}
+	if config.Server != nil {
+		socksConfig.Address, socksConfig.Port = reverseServerAddress(config.Server)
+		if u := config.Server.User; u != nil {
+			socksConfig.Level, socksConfig.Email = u.Level, u.Email
+			if u.Account != nil {
+				instance, err := u.Account.GetInstance()
+				if err != nil {
+					return nil, err
+				}
+				account, ok := instance.(*socks.Account)
+				if !ok {
+					return nil, fmt.Errorf("unexpected socks account type %s", u.Account.Type)
+				}
+				socksConfig.Username, socksConfig.Password = account.Username, account.Password
+			}
+		}
+	}
+	return json.Marshal(socksConfig)
 }
 
 // ReverseWireguardOutbound reverse-maps a wireguard.DeviceConfig to a conf.WireGuardConfig
 func ReverseWireguardOutbound(config *wireguard.DeviceConfig) (json.RawMessage, error) {
 	return ReverseWireguardInbound(config)
 }
+
+// reverseServerAddress returns the address and port of an outbound's server.
+func reverseServerAddress(server *protocol.ServerEndpoint) (*conf.Address, uint16) {
+	if server.Address == nil {
+		return nil, uint16(server.Port)
+	}
+	return &conf.Address{Address: server.Address.AsAddress()}, uint16(server.Port)
+}
+
+// int32Range converts a min/max pair to the "min-max" range of Xray's JSON configuration.
+func int32Range(min, max uint64) *conf.Int32Range {
+	return &conf.Int32Range{Left: int32(min), Right: int32(max), From: int32(min), To: int32(max)}
+}
+
+// sortedKeys returns the keys of an accounts map in order, so that reverse-mapped accounts are stable.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
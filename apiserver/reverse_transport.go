@@ -0,0 +1,239 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/transport/internet/grpc"
+	"github.com/xtls/xray-core/transport/internet/headers/dns"
+	"github.com/xtls/xray-core/transport/internet/headers/http"
+	"github.com/xtls/xray-core/transport/internet/headers/noop"
+	"github.com/xtls/xray-core/transport/internet/headers/srtp"
+	headertls "github.com/xtls/xray-core/transport/internet/headers/tls"
+	"github.com/xtls/xray-core/transport/internet/headers/utp"
+	"github.com/xtls/xray-core/transport/internet/headers/wechat"
+	"github.com/xtls/xray-core/transport/internet/headers/wireguard"
+	"github.com/xtls/xray-core/transport/internet/httpupgrade"
+	"github.com/xtls/xray-core/transport/internet/kcp"
+	"github.com/xtls/xray-core/transport/internet/tcp"
+	"github.com/xtls/xray-core/transport/internet/websocket"
+)
+
+// reverseTransportProtocolName maps the internal name of a transport, as held in
+// internet.StreamConfig, back to the name used in configuration files.
+func reverseTransportProtocolName(name string) string {
+	switch name {
+	case "tcp":
+		return "raw"
+	case "splithttp":
+		return "xhttp"
+	case "websocket":
+		return "ws"
+	case "mkcp":
+		return "kcp"
+	default:
+		return name
+	}
+}
+
+// ReverseTCPSettings converts *tcp.Config to *conf.TCPConfig, including the HTTP header obfuscation.
+func ReverseTCPSettings(c *tcp.Config) *conf.TCPConfig {
+	if c == nil {
+		return nil
+	}
+	return &conf.TCPConfig{
+		HeaderConfig:        reverseTCPHeader(c.HeaderSettings),
+		AcceptProxyProtocol: c.AcceptProxyProtocol,
+	}
+}
+
+// ReverseWebSocketSettings converts *websocket.Config to *conf.WebSocketConfig
+func ReverseWebSocketSettings(c *websocket.Config) *conf.WebSocketConfig {
+	if c == nil {
+		return nil
+	}
+	return &conf.WebSocketConfig{
+		Host:                c.Host,
+		Path:                pathWithEarlyData(c.Path, c.Ed),
+		Headers:             c.Header,
+		AcceptProxyProtocol: c.AcceptProxyProtocol,
+		HeartbeatPeriod:     c.HeartbeatPeriod,
+	}
+}
+
+// ReverseHTTPUpgradeSettings converts *httpupgrade.Config to *conf.HttpUpgradeConfig
+func ReverseHTTPUpgradeSettings(c *httpupgrade.Config) *conf.HttpUpgradeConfig {
+	if c == nil {
+		return nil
+	}
+	return &conf.HttpUpgradeConfig{
+		Host:                c.Host,
+		Path:                pathWithEarlyData(c.Path, c.Ed),
+		Headers:             c.Header,
+		AcceptProxyProtocol: c.AcceptProxyProtocol,
+	}
+}
+
+// ReverseGRPCSettings converts *grpc.Config to *conf.GRPCConfig
+func ReverseGRPCSettings(c *grpc.Config) *conf.GRPCConfig {
+	if c == nil {
+		return nil
+	}
+	return &conf.GRPCConfig{
+		Authority:           c.Authority,
+		ServiceName:         c.ServiceName,
+		MultiMode:           c.MultiMode,
+		IdleTimeout:         c.IdleTimeout,
+		HealthCheckTimeout:  c.HealthCheckTimeout,
+		PermitWithoutStream: c.PermitWithoutStream,
+		InitialWindowsSize:  c.InitialWindowsSize,
+		UserAgent:           c.UserAgent,
+	}
+}
+
+// ReverseKCPSettings converts *kcp.Config to *conf.KCPConfig
+func ReverseKCPSettings(c *kcp.Config) *conf.KCPConfig {
+	if c == nil {
+		return nil
+	}
+	cs := &conf.KCPConfig{
+		HeaderConfig: reverseKCPHeader(c.HeaderConfig),
+	}
+	if c.Mtu != nil {
+		cs.Mtu = &c.Mtu.Value
+	}
+	if c.Tti != nil {
+		cs.Tti = &c.Tti.Value
+	}
+	if c.UplinkCapacity != nil {
+		cs.UpCap = &c.UplinkCapacity.Value
+	}
+	if c.DownlinkCapacity != nil {
+		cs.DownCap = &c.DownlinkCapacity.Value
+	}
+	congestion := c.Congestion
+	cs.Congestion = &congestion
+	// Buffer sizes are configured in MB; the 512 KB used for 0 maps back to 0
+	if c.ReadBuffer != nil {
+		size := c.ReadBuffer.Size / (1024 * 1024)
+		cs.ReadBufferSize = &size
+	}
+	if c.WriteBuffer != nil {
+		size := c.WriteBuffer.Size / (1024 * 1024)
+		cs.WriteBufferSize = &size
+	}
+	if c.Seed != nil {
+		cs.Seed = &c.Seed.Seed
+	}
+	return cs
+}
+
+// pathWithEarlyData puts the early data length, which Xray-core takes out of the path's "ed"
+// query parameter, back into the path.
+func pathWithEarlyData(path string, ed uint32) string {
+	if ed == 0 {
+		return path
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%sed=%d", path, separator, ed)
+}
+
+// reverseTCPHeader converts the header obfuscation of a raw (TCP) transport to its "header" object.
+func reverseTCPHeader(tm *serial.TypedMessage) json.RawMessage {
+	if tm == nil {
+		return nil
+	}
+	instance, err := tm.GetInstance()
+	if err != nil {
+		return nil
+	}
+
+	header := map[string]interface{}{}
+	switch h := instance.(type) {
+	case *noop.ConnectionConfig:
+		header["type"] = "none"
+	case *http.Config:
+		header["type"] = "http"
+		if h.Request != nil {
+			request := map[string]interface{}{
+				"path":    h.Request.Uri,
+				"headers": reverseHTTPHeaders(h.Request.Header),
+			}
+			if h.Request.Version != nil {
+				request["version"] = h.Request.Version.Value
+			}
+			if h.Request.Method != nil {
+				request["method"] = h.Request.Method.Value
+			}
+			header["request"] = request
+		}
+		if h.Response != nil {
+			response := map[string]interface{}{
+				"headers": reverseHTTPHeaders(h.Response.Header),
+			}
+			if h.Response.Version != nil {
+				response["version"] = h.Response.Version.Value
+			}
+			if h.Response.Status != nil {
+				response["status"] = h.Response.Status.Code
+				response["reason"] = h.Response.Status.Reason
+			}
+			header["response"] = response
+		}
+	default:
+		return nil
+	}
+
+	data, _ := json.Marshal(header)
+	return data
+}
+
+// reverseKCPHeader converts the packet header of an mKCP transport to its "header" object.
+func reverseKCPHeader(tm *serial.TypedMessage) json.RawMessage {
+	if tm == nil {
+		return nil
+	}
+	instance, err := tm.GetInstance()
+	if err != nil {
+		return nil
+	}
+
+	header := map[string]interface{}{}
+	switch h := instance.(type) {
+	case *noop.Config:
+		header["type"] = "none"
+	case *srtp.Config:
+		header["type"] = "srtp"
+	case *utp.Config:
+		header["type"] = "utp"
+	case *wechat.VideoConfig:
+		header["type"] = "wechat-video"
+	case *headertls.PacketConfig:
+		header["type"] = "dtls"
+	case *wireguard.WireguardConfig:
+		header["type"] = "wireguard"
+	case *dns.Config:
+		header["type"] = "dns"
+		header["domain"] = h.Domain
+	default:
+		return nil
+	}
+
+	data, _ := json.Marshal(header)
+	return data
+}
+
+// reverseHTTPHeaders converts HTTP header obfuscation headers to a name -> values map.
+func reverseHTTPHeaders(headers []*http.Header) map[string][]string {
+	result := make(map[string][]string, len(headers))
+	for _, h := range headers {
+		result[h.Name] = append(result[h.Name], h.Value...)
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+package apiserver
+
+import (
+	"encoding/json"
+
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/proxy/trojan"
+)
+
+// TrojanUserConfig is a user-facing struct for a Trojan user.
+type TrojanUserConfig struct {
+	Password string `json:"password"`
+	Level    uint32 `json:"level"`
+	Email    string `json:"email"`
+}
+
+// TrojanInboundFallbackConfig is a user-facing struct for Trojan fallbacks.
+type TrojanInboundFallbackConfig struct {
+	Name string `json:"name,omitempty"`
+	Alpn string `json:"alpn,omitempty"`
+	Path string `json:"path,omitempty"`
+	Type string `json:"type,omitempty"`
+	Dest string `json:"dest,omitempty"`
+	Xver uint64 `json:"xver,omitempty"`
+}
+
+// ReverseTrojanInbound converts a trojan.ServerConfig to a conf.TrojanServerConfig's settings
+func ReverseTrojanInbound(config *trojan.ServerConfig) (json.RawMessage, error) {
+	var clientMessages []json.RawMessage
+	for _, u := range config.Users {
+		instance, err := u.Account.GetInstance()
+		if err != nil {
+			return nil, err
+		}
+		trojanAccount := instance.(*trojan.Account)
+		user := &TrojanUserConfig{
+			Password: trojanAccount.Password,
+			Level:    u.Level,
+			Email:    u.Email,
+		}
+		userBytes, err := json.Marshal(user)
+		if err != nil {
+			return nil, err
+		}
+		clientMessages = append(clientMessages, userBytes)
+	}
+
+	var fallbacks []*TrojanInboundFallbackConfig
+	for _, f := range config.Fallbacks {
+		fallbacks = append(fallbacks, &TrojanInboundFallbackConfig{
+			Name: f.Name,
+			Alpn: f.Alpn,
+			Path: f.Path,
+			Type: f.Type,
+			Dest: f.Dest,
+			Xver: f.Xver,
+		})
+	}
+
+	settings := struct {
+		Clients   []json.RawMessage              `json:"clients"`
+		Fallbacks []*TrojanInboundFallbackConfig `json:"fallbacks"`
+	}{
+		Clients:   clientMessages,
+		Fallbacks: fallbacks,
+	}
+
+	return json.Marshal(settings)
+}
+
+// ReverseTrojanOutbound converts a trojan.ClientConfig to a conf.TrojanClientConfig's settings
+func ReverseTrojanOutbound(config *trojan.ClientConfig) (json.RawMessage, error) {
+	settings := &conf.TrojanClientConfig{}
+	if config.Server != nil {
+		settings.Address, settings.Port = reverseServerAddress(config.Server)
+		if u := config.Server.User; u != nil {
+			instance, err := u.Account.GetInstance()
+			if err != nil {
+				return nil, err
+			}
+			trojanAccount := instance.(*trojan.Account)
+			settings.Password = trojanAccount.Password
+			settings.Level = byte(u.Level)
+			settings.Email = u.Email
+		}
+	}
+
+	return json.Marshal(settings)
+}
@@ -8,6 +8,20 @@ import (
 func (s *APIServer) RegisterHandlers(r *chi.Mux) {
 	r.Get("/status", s.HandleStatus)
 	r.Get("/subscription", s.HandleSubscription)
+	r.Get("/subscription/{token}", s.HandleSubscriptionToken)
+
+	// Subscription tokens, admin only
+	r.Get("/subscription/tokens", s.requireAdmin(s.handleListSubscriptionTokens()))
+	r.Get("/subscription/tokens/{email}", s.requireAdmin(s.handleGetSubscriptionToken()))
+	r.Post("/subscription/tokens/{email}", s.requireAdmin(s.handleIssueSubscriptionToken()))
+	r.Delete("/subscription/tokens/{email}", s.requireAdmin(s.handleRevokeSubscriptionToken()))
+
+	// Subscription profiles, admin only
+	r.Get("/subscription/profiles", s.requireAdmin(s.handleListSubscriptionProfiles()))
+	r.Post("/subscription/profiles", s.requireAdmin(s.handleAddSubscriptionProfile()))
+	r.Get("/subscription/profiles/{index}", s.requireAdmin(s.handleGetSubscriptionProfile()))
+	r.Put("/subscription/profiles/{index}", s.requireAdmin(s.handleUpdateSubscriptionProfile()))
+	r.Delete("/subscription/profiles/{index}", s.requireAdmin(s.handleRemoveSubscriptionProfile()))
 
 
 	// StatsService
@@ -16,6 +30,8 @@ func (s *APIServer) RegisterHandlers(r *chi.Mux) {
 	r.Get("/stats/query", s.handleQueryStats())
 	r.Get("/stats/online", s.handleGetStatsOnline())
 	r.Get("/stats/online/iplist", s.handleGetStatsOnlineIpList())
+	r.Get("/stats/online/users", s.handleGetOnlineUsers())
+	r.Get("/stats/history", s.handleGetStatsHistory())
 
 	// HandlerService
 	r.Get("/inbound", s.handleListInbounds())
@@ -24,6 +40,7 @@ func (s *APIServer) RegisterHandlers(r *chi.Mux) {
 	r.Put("/inbound/{tag}", s.handleAlterInbound())
 	r.Post("/inbound/{tag}/users", s.handleAddInboundUsers())
 	r.Delete("/inbound/{tag}/users", s.handleRemoveInboundUsers())
+	r.Put("/inbound/{tag}/users/state", s.handleSetInboundUsersState())
 	r.Get("/inbound/{tag}/users", s.handleGetInboundUsers())
 	r.Get("/inbound/{tag}/users/count", s.handleGetInboundUsersCount())
 
@@ -31,6 +48,28 @@ func (s *APIServer) RegisterHandlers(r *chi.Mux) {
 	r.Post("/outbound", s.handleAddOutbound())
 	r.Delete("/outbound/{tag}", s.handleRemoveOutbound())
 
+	// Users
+	r.Get("/users/traffic", s.handleListUserTraffic())
+	r.Get("/users/{email}/traffic", s.handleGetUserTraffic())
+	r.Get("/users/suspended", s.handleListSuspendedUsers())
+	r.Get("/users/quota", s.handleListUserQuotas())
+	r.Get("/users/{email}/quota", s.handleGetUserQuota())
+	r.Put("/users/{email}/quota", s.handleSetUserQuota())
+	r.Delete("/users/{email}/quota", s.handleRemoveUserQuota())
+	r.Post("/users/{email}/quota/reset", s.handleResetUserQuota())
+	r.Get("/users/expired", s.handleListExpiredUsers())
+	r.Get("/users/{email}/expiry", s.handleGetUserExpiry())
+	r.Put("/users/{email}/expiry", s.handleSetUserExpiry())
+	r.Delete("/users/{email}/expiry", s.handleRemoveUserExpiry())
+	r.Get("/users/device-limit", s.handleListDeviceLimits())
+	r.Get("/users/{email}/device-limit", s.handleGetDeviceLimit())
+	r.Put("/users/{email}/device-limit", s.handleSetDeviceLimit())
+	r.Delete("/users/{email}/device-limit", s.handleRemoveDeviceLimit())
+	r.Get("/users/short-ids", s.handleListShortIDs())
+	r.Get("/users/{email}/short-ids", s.handleGetUserShortIDs())
+	r.Put("/users/{email}/short-ids", s.handleReassignUserShortID())
+	r.Delete("/users/{email}/short-ids", s.handleRemoveUserShortIDs())
+
 	// RoutingService
 	r.Post("/routing/rule", s.handleAddRoutingRule())
 	r.Delete("/routing/rule/{tag}", s.handleRemoveRoutingRule())
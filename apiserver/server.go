@@ -4,11 +4,13 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"xray-api-bridge/store"
 	"xray-api-bridge/xrayapi"
 )
 
@@ -16,14 +18,24 @@ import (
 type APIServer struct {
 	httpServer    *http.Server
 	xrayClient    *xrayapi.Client
-	subsConfigPath string
+	subsProfiles  *subscriptionProfileSet
+	adminKey      string // XRAY_API_BRIDGE_SUBS_SUPERKEY, required by the admin-scoped endpoints
+	subsOptions   SubscriptionOptions
+	store         *store.Store
+
+	suspendMu     sync.Mutex // serializes suspending and resuming users
+	quotaMu       sync.Mutex // serializes quota accounting and changes
+	expiryMu      sync.Mutex // serializes expiring users and expiry changes
+	deviceMu      sync.Mutex // serializes device limit enforcement and changes
+	shortIDMu     sync.Mutex // serializes REALITY shortId assignments
+	lastQuotaPoll time.Time
 
 	// Store current listen address for reloading, though reload logic might need rework
 	currentListenAddr string
 }
 
 // NewAPIServer creates a new APIServer instance.
-func NewAPIServer(xrayClient *xrayapi.Client, listenAddr, subsConfigPath string) *APIServer {
+func NewAPIServer(xrayClient *xrayapi.Client, listenAddr, subsConfigPath, adminKey string, subsOptions SubscriptionOptions, bridgeStore *store.Store) *APIServer {
 	r := chi.NewRouter()
 
 	// A good base middleware stack
@@ -46,7 +58,10 @@ func NewAPIServer(xrayClient *xrayapi.Client, listenAddr, subsConfigPath string)
 			WriteTimeout: 10 * time.Second,
 			IdleTimeout:  120 * time.Second,
 		},
-		subsConfigPath:    subsConfigPath,
+		subsProfiles:      newSubscriptionProfileSet(subsConfigPath),
+		adminKey:          adminKey,
+		subsOptions:       subsOptions,
+		store:             bridgeStore,
 		currentListenAddr: listenAddr,
 	}
 
@@ -0,0 +1,203 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	proxyman_command "github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/infra/conf"
+
+	"xray-api-bridge/store"
+)
+
+// errNotRealityInbound is returned when a tag does not name a REALITY inbound with shortIds.
+var errNotRealityInbound = errors.New("not a REALITY inbound with shortIds")
+
+// storedShortID returns the REALITY shortId assigned to a user on an inbound, if the inbound
+// still lists it. Subscriptions only read assignments; they are made when users are added.
+func (s *APIServer) storedShortID(tag, email string, shortIDs []string) (string, bool) {
+	sid, ok := s.store.ShortIDs.Get(tag, email)
+	if !ok || !containsString(shortIDs, sid.ShortID) {
+		return "", false
+	}
+	return sid.ShortID, true
+}
+
+// assignUserShortIDs gives users added to an inbound a REALITY shortId, when the inbound is a
+// REALITY inbound with shortIds. Users already holding one the inbound lists keep it.
+func (s *APIServer) assignUserShortIDs(ctx context.Context, tag string, users ...SimplifiedUser) {
+	if len(users) == 0 {
+		return
+	}
+	shortIDs, err := s.inboundShortIDs(ctx, tag)
+	if err != nil {
+		if !errors.Is(err, errNotRealityInbound) {
+			log.Printf("Warning: failed to read REALITY shortIds of inbound %s: %v", tag, err)
+		}
+		return
+	}
+	for _, u := range users {
+		if _, err := s.userShortID(tag, u.Email, shortIDs); err != nil {
+			log.Printf("Warning: failed to assign a REALITY shortId to %s on inbound %s: %v", u.Email, tag, err)
+		}
+	}
+}
+
+// assignStoredShortIDs gives every stored user of a REALITY inbound a shortId, covering users
+// stored before they were assigned on add and inbounds whose shortIds have changed.
+func (s *APIServer) assignStoredShortIDs(ctx context.Context) {
+	shortIDsByTag, err := s.realityShortIDs(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to read REALITY shortIds: %v", err)
+		return
+	}
+	for _, u := range s.store.Users.List() {
+		shortIDs, ok := shortIDsByTag[u.Tag]
+		if !ok {
+			continue
+		}
+		if _, err := s.userShortID(u.Tag, u.Email, shortIDs); err != nil {
+			log.Printf("Warning: failed to assign a REALITY shortId to %s on inbound %s: %v", u.Email, u.Tag, err)
+		}
+	}
+}
+
+// dropShortIDs removes the assignments of users removed from an inbound, so that they no longer
+// count towards the usage of their shortIds.
+func (s *APIServer) dropShortIDs(tag string, emails ...string) {
+	if len(emails) == 0 {
+		return
+	}
+	s.shortIDMu.Lock()
+	defer s.shortIDMu.Unlock()
+
+	if err := s.store.ShortIDs.Delete(tag, emails...); err != nil {
+		log.Printf("Warning: failed to drop REALITY shortIds of users removed from inbound %s: %v", tag, err)
+	}
+}
+
+// userShortID returns the REALITY shortId of a user on an inbound, assigning one if the user has
+// none there. An assignment to a shortId the inbound no longer lists is replaced.
+func (s *APIServer) userShortID(tag, email string, shortIDs []string) (string, error) {
+	s.shortIDMu.Lock()
+	defer s.shortIDMu.Unlock()
+
+	if sid, ok := s.store.ShortIDs.Get(tag, email); ok && containsString(shortIDs, sid.ShortID) {
+		return sid.ShortID, nil
+	}
+	return s.assignShortID(tag, email, shortIDs, "")
+}
+
+// reassignShortID gives a user another shortId on an inbound: the given one, or else the least
+// used one other than the current one.
+func (s *APIServer) reassignShortID(tag, email string, shortIDs []string, shortID string) (string, error) {
+	s.shortIDMu.Lock()
+	defer s.shortIDMu.Unlock()
+
+	if shortID != "" {
+		if !containsString(shortIDs, shortID) {
+			return "", fmt.Errorf("shortId '%s' is not listed by inbound %s", shortID, tag)
+		}
+		return shortID, s.store.ShortIDs.Put(store.ShortID{Tag: tag, Email: email, ShortID: shortID, AssignedAt: time.Now()})
+	}
+
+	current, _ := s.store.ShortIDs.Get(tag, email)
+	return s.assignShortID(tag, email, shortIDs, current.ShortID)
+}
+
+// assignShortID assigns the user the shortId held by the fewest other users of the inbound, in
+// the order the inbound lists them, so that new users get unused ones while there are any.
+// The empty shortId is only used when the inbound lists nothing else. Callers hold shortIDMu.
+func (s *APIServer) assignShortID(tag, email string, shortIDs []string, exclude string) (string, error) {
+	usage := make(map[string]int)
+	for _, sid := range s.store.ShortIDs.ListByTag(tag) {
+		if sid.Email != email {
+			usage[sid.ShortID]++
+		}
+	}
+
+	chosen, found := "", false
+	for _, candidate := range shortIDs {
+		if candidate == exclude || (candidate == "" && len(shortIDs) > 1) {
+			continue
+		}
+		if !found || usage[candidate] < usage[chosen] {
+			chosen, found = candidate, true
+		}
+	}
+	if !found {
+		// Nothing else to move to
+		chosen = exclude
+	}
+
+	if err := s.store.ShortIDs.Put(store.ShortID{Tag: tag, Email: email, ShortID: chosen, AssignedAt: time.Now()}); err != nil {
+		return "", err
+	}
+	return chosen, nil
+}
+
+// inboundShortIDs reads the REALITY shortIds of an inbound from Xray-core.
+func (s *APIServer) inboundShortIDs(ctx context.Context, tag string) ([]string, error) {
+	resp, err := s.xrayClient.HandlerClient.ListInbounds(ctx, &proxyman_command.ListInboundsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list inbounds: %w", err)
+	}
+	for _, inbound := range resp.GetInbounds() {
+		if inbound.Tag != tag {
+			continue
+		}
+		confInbound, err := ReverseInbound(inbound)
+		if err != nil {
+			return nil, fmt.Errorf("could not read inbound %s: %w", tag, err)
+		}
+		if shortIDs := realityShortIDsOf(confInbound); len(shortIDs) > 0 {
+			return shortIDs, nil
+		}
+		break
+	}
+	return nil, fmt.Errorf("inbound %s: %w", tag, errNotRealityInbound)
+}
+
+// realityShortIDs reads the REALITY shortIds of every REALITY inbound from Xray-core, by tag.
+func (s *APIServer) realityShortIDs(ctx context.Context) (map[string][]string, error) {
+	resp, err := s.xrayClient.HandlerClient.ListInbounds(ctx, &proxyman_command.ListInboundsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list inbounds: %w", err)
+	}
+	shortIDsByTag := make(map[string][]string)
+	for _, inbound := range resp.GetInbounds() {
+		confInbound, err := ReverseInbound(inbound)
+		if err != nil {
+			continue
+		}
+		if shortIDs := realityShortIDsOf(confInbound); len(shortIDs) > 0 {
+			shortIDsByTag[inbound.Tag] = shortIDs
+		}
+	}
+	return shortIDsByTag, nil
+}
+
+// realityShortIDsOf returns the REALITY shortIds of an inbound, or nil for other inbounds.
+func realityShortIDsOf(inbound *conf.InboundDetourConfig) []string {
+	stream := inbound.StreamSetting
+	if stream == nil || stream.Security != "reality" || stream.REALITYSettings == nil {
+		return nil
+	}
+	return stream.REALITYSettings.ShortIds
+}
+
+func newShortIDResponses(shortIDs []store.ShortID) []ShortIDResponse {
+	resp := make([]ShortIDResponse, 0, len(shortIDs))
+	for _, sid := range shortIDs {
+		resp = append(resp, ShortIDResponse{
+			Tag:        sid.Tag,
+			Email:      sid.Email,
+			ShortID:    sid.ShortID,
+			AssignedAt: sid.AssignedAt,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,378 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the proxy groups added to a Clash configuration whose template defines none.
+const (
+	clashSelectGroupName  = "Proxy"
+	clashURLTestGroupName = "Auto"
+)
+
+// defaultClashTemplate is used when XRAY_API_BRIDGE_SUBS_CLASH_TEMPLATE is not set.
+// Its rules send everything but private and mainland China destinations to the Proxy group.
+const defaultClashTemplate = `
+mixed-port: 7890
+allow-lan: false
+mode: rule
+log-level: info
+rules:
+  - GEOSITE,private,DIRECT
+  - GEOIP,private,DIRECT,no-resolve
+  - GEOSITE,cn,DIRECT
+  - GEOIP,CN,DIRECT
+  - MATCH,Proxy
+`
+
+// clashConfig is a Clash.Meta configuration. Settings holds whatever the template defines
+// besides proxies, proxy groups and rules, and is passed through untouched.
+type clashConfig struct {
+	Settings    map[string]interface{} `yaml:",inline"`
+	Proxies     []interface{}          `yaml:"proxies"`
+	ProxyGroups []interface{}          `yaml:"proxy-groups"`
+	Rules       []string               `yaml:"rules"`
+}
+
+type clashProxy struct {
+	Name              string            `yaml:"name"`
+	Type              string            `yaml:"type"`
+	Server            string            `yaml:"server"`
+	Port              uint16            `yaml:"port"`
+	UUID              string            `yaml:"uuid,omitempty"`
+	Password          string            `yaml:"password,omitempty"`
+	AlterID           *int              `yaml:"alterId,omitempty"`
+	Cipher            string            `yaml:"cipher,omitempty"`
+	Encryption        string            `yaml:"encryption,omitempty"`
+	Flow              string            `yaml:"flow,omitempty"`
+	UDP               bool              `yaml:"udp"`
+	Network           string            `yaml:"network,omitempty"`
+	TLS               bool              `yaml:"tls,omitempty"`
+	ServerName        string            `yaml:"servername,omitempty"`
+	SNI               string            `yaml:"sni,omitempty"` // trojan
+	ALPN              []string          `yaml:"alpn,omitempty"`
+	ClientFingerprint string            `yaml:"client-fingerprint,omitempty"`
+	ECHOpts           *clashECHOpts     `yaml:"ech-opts,omitempty"`
+	RealityOpts       *clashRealityOpts `yaml:"reality-opts,omitempty"`
+	WSOpts            *clashWSOpts      `yaml:"ws-opts,omitempty"`
+	H2Opts            *clashH2Opts      `yaml:"h2-opts,omitempty"`
+	GRPCOpts          *clashGRPCOpts    `yaml:"grpc-opts,omitempty"`
+	XHTTPOpts         *clashXHTTPOpts   `yaml:"xhttp-opts,omitempty"`
+
+	// sniOnly is set for protocols that always use TLS and only take its server name, as sni.
+	sniOnly bool
+}
+
+type clashECHOpts struct {
+	Enable bool   `yaml:"enable"`
+	Config string `yaml:"config,omitempty"`
+}
+
+type clashRealityOpts struct {
+	PublicKey string `yaml:"public-key"`
+	ShortID   string `yaml:"short-id,omitempty"`
+}
+
+type clashWSOpts struct {
+	Path             string            `yaml:"path,omitempty"`
+	Headers          map[string]string `yaml:"headers,omitempty"`
+	V2rayHTTPUpgrade bool              `yaml:"v2ray-http-upgrade,omitempty"`
+}
+
+type clashH2Opts struct {
+	Host []string `yaml:"host,omitempty"`
+	Path string   `yaml:"path,omitempty"`
+}
+
+type clashGRPCOpts struct {
+	GRPCServiceName string `yaml:"grpc-service-name,omitempty"`
+}
+
+type clashXHTTPOpts struct {
+	Path             string                      `yaml:"path,omitempty"`
+	Host             string                      `yaml:"host,omitempty"`
+	Mode             string                      `yaml:"mode,omitempty"`
+	Headers          map[string]string           `yaml:"headers,omitempty"`
+	NoGRPCHeader     bool                        `yaml:"no-grpc-header,omitempty"`
+	XPaddingBytes    string                      `yaml:"x-padding-bytes,omitempty"`
+	DownloadSettings *clashXHTTPDownloadSettings `yaml:"download-settings,omitempty"`
+}
+
+type clashXHTTPDownloadSettings struct {
+	Path              string            `yaml:"path,omitempty"`
+	Host              string            `yaml:"host,omitempty"`
+	Server            string            `yaml:"server"`
+	Port              uint16            `yaml:"port"`
+	TLS               bool              `yaml:"tls,omitempty"`
+	ServerName        string            `yaml:"servername,omitempty"`
+	ALPN              []string          `yaml:"alpn,omitempty"`
+	ClientFingerprint string            `yaml:"client-fingerprint,omitempty"`
+	RealityOpts       *clashRealityOpts `yaml:"reality-opts,omitempty"`
+}
+
+type clashProxyGroup struct {
+	Name     string   `yaml:"name"`
+	Type     string   `yaml:"type"`
+	Proxies  []string `yaml:"proxies"`
+	URL      string   `yaml:"url,omitempty"`
+	Interval int      `yaml:"interval,omitempty"`
+}
+
+// xhttpExtra is the part of the xhttp `extra` object Clash.Meta has options for.
+type xhttpExtra struct {
+	Headers          map[string]string `json:"headers"`
+	XPaddingBytes    json.RawMessage   `json:"xPaddingBytes"`
+	NoGRPCHeader     bool              `json:"noGRPCHeader"`
+	DownloadSettings *struct {
+		Address     string `json:"address"`
+		Port        uint16 `json:"port"`
+		Security    string `json:"security"`
+		TLSSettings *struct {
+			ServerName  string   `json:"serverName"`
+			Alpn        []string `json:"alpn"`
+			Fingerprint string   `json:"fingerprint"`
+		} `json:"tlsSettings"`
+		RealitySettings *struct {
+			ServerName  string `json:"serverName"`
+			Fingerprint string `json:"fingerprint"`
+			Password    string `json:"password"`
+			PublicKey   string `json:"publicKey"`
+			ShortID     string `json:"shortId"`
+		} `json:"realitySettings"`
+		XHTTPSettings *struct {
+			Host string `json:"host"`
+			Path string `json:"path"`
+		} `json:"xhttpSettings"`
+	} `json:"downloadSettings"`
+}
+
+// renderClashConfig renders the nodes as a Clash.Meta configuration, built on the template at
+// opts.ClashTemplate. Proxy groups are only added when the template has none,
+// and the default rules only when it has no rules.
+func renderClashConfig(opts SubscriptionOptions, nodes []subscriptionNode) ([]byte, error) {
+	config, err := loadClashTemplate(opts.ClashTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	names := uniqueNodeNames(nodes)
+	var proxyNames []string
+	for i, node := range nodes {
+		proxy, err := newClashProxy(node, names[i])
+		if err != nil {
+			log.Printf("Warning: skipping subscription node %s for Clash: %v", names[i], err)
+			continue
+		}
+		config.Proxies = append(config.Proxies, proxy)
+		proxyNames = append(proxyNames, proxy.Name)
+	}
+	if len(proxyNames) == 0 {
+		return nil, fmt.Errorf("none of the subscription nodes can be expressed as a Clash proxy")
+	}
+
+	if len(config.ProxyGroups) == 0 {
+		config.ProxyGroups = []interface{}{
+			clashProxyGroup{
+				Name:    clashSelectGroupName,
+				Type:    "select",
+				Proxies: append([]string{clashURLTestGroupName}, proxyNames...),
+			},
+			clashProxyGroup{
+				Name:     clashURLTestGroupName,
+				Type:     "url-test",
+				Proxies:  proxyNames,
+				URL:      "https://www.gstatic.com/generate_204",
+				Interval: 300,
+			},
+		}
+	}
+	if len(config.Rules) == 0 {
+		var defaults clashConfig
+		if err := yaml.Unmarshal([]byte(defaultClashTemplate), &defaults); err != nil {
+			return nil, fmt.Errorf("could not parse default Clash template: %w", err)
+		}
+		config.Rules = defaults.Rules
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return nil, fmt.Errorf("could not encode Clash configuration: %w", err)
+	}
+	encoder.Close()
+	return buf.Bytes(), nil
+}
+
+// loadClashTemplate reads the Clash configuration template, or the built-in one when path is empty.
+func loadClashTemplate(path string) (clashConfig, error) {
+	data := []byte(defaultClashTemplate)
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return clashConfig{}, fmt.Errorf("could not read Clash template %s: %w", path, err)
+		}
+	}
+
+	var config clashConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return clashConfig{}, fmt.Errorf("could not decode Clash template %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// newClashProxy converts a subscription node into a Clash.Meta proxy. The subscription adapter
+// of the node's protocol sets the protocol fields.
+func newClashProxy(node subscriptionNode, name string) (clashProxy, error) {
+	adapter, ok := subscriptionAdapterOf(node.Protocol)
+	if !ok {
+		return clashProxy{}, fmt.Errorf("unsupported protocol '%s'", node.Protocol)
+	}
+	proxy := clashProxy{
+		Name:   name,
+		Type:   node.Protocol,
+		Server: node.Address,
+		Port:   node.Port,
+		UDP:    true,
+	}
+	streamSettings, err := adapter.ClashProxy(node, &proxy)
+	if err != nil {
+		return clashProxy{}, err
+	}
+	if !streamSettings {
+		return proxy, nil
+	}
+
+	switch node.Network {
+	case "raw":
+	case "xhttp":
+		proxy.Network = "xhttp"
+		opts, err := newClashXHTTPOpts(node)
+		if err != nil {
+			return clashProxy{}, err
+		}
+		proxy.XHTTPOpts = opts
+	case "ws", "httpupgrade":
+		proxy.Network = "ws"
+		proxy.WSOpts = &clashWSOpts{
+			Path:             node.Path,
+			Headers:          map[string]string{"Host": node.Host},
+			V2rayHTTPUpgrade: node.Network == "httpupgrade",
+		}
+	case "http":
+		proxy.Network = "h2"
+		proxy.H2Opts = &clashH2Opts{Host: strings.Split(node.Host, ","), Path: node.Path}
+	case "grpc":
+		proxy.Network = "grpc"
+		proxy.GRPCOpts = &clashGRPCOpts{GRPCServiceName: node.ServiceName}
+	default:
+		return clashProxy{}, fmt.Errorf("unsupported network '%s'", node.Network)
+	}
+
+	switch node.Security {
+	case "tls":
+		proxy.setServerName(node)
+		proxy.ALPN = node.Alpn
+		proxy.ClientFingerprint = node.Fingerprint
+		if node.EchConfigList != "" {
+			proxy.ECHOpts = &clashECHOpts{Enable: true}
+			// A DNS query (e.g. "example.com+https://1.1.1.1/dns-query") is left to the client
+			if !strings.Contains(node.EchConfigList, "://") {
+				proxy.ECHOpts.Config = node.EchConfigList
+			}
+		}
+	case "reality":
+		proxy.setServerName(node)
+		proxy.ClientFingerprint = node.Fingerprint
+		proxy.RealityOpts = &clashRealityOpts{PublicKey: node.PublicKey, ShortID: node.ShortID}
+	}
+	return proxy, nil
+}
+
+// setServerName enables TLS with the server name of the node, or only sets the sni of protocols
+// that always use TLS.
+func (p *clashProxy) setServerName(node subscriptionNode) {
+	if p.sniOnly {
+		p.SNI = node.ServerName
+		return
+	}
+	p.TLS = true
+	p.ServerName = node.ServerName
+}
+
+// newClashXHTTPOpts converts the xhttp settings of a node, including the downloadSettings of
+// its extra object, into Clash.Meta xhttp options.
+func newClashXHTTPOpts(node subscriptionNode) (*clashXHTTPOpts, error) {
+	opts := &clashXHTTPOpts{Path: node.Path, Host: node.Host, Mode: node.Mode}
+	if node.Extra == nil {
+		return opts, nil
+	}
+
+	extraBytes, err := json.Marshal(node.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode xhttp extra: %w", err)
+	}
+	var extra xhttpExtra
+	if err := json.Unmarshal(extraBytes, &extra); err != nil {
+		return nil, fmt.Errorf("could not decode xhttp extra: %w", err)
+	}
+	opts.Headers = extra.Headers
+	opts.NoGRPCHeader = extra.NoGRPCHeader
+	if len(extra.XPaddingBytes) > 0 {
+		opts.XPaddingBytes = strings.Trim(string(extra.XPaddingBytes), `"`)
+	}
+
+	ds := extra.DownloadSettings
+	if ds == nil {
+		return opts, nil
+	}
+	download := &clashXHTTPDownloadSettings{
+		Path:   node.Path,
+		Host:   node.Host,
+		Server: ds.Address,
+		Port:   ds.Port,
+	}
+	if download.Server == "" {
+		download.Server = node.Address
+	}
+	if download.Port == 0 {
+		download.Port = node.Port
+	}
+	if ds.XHTTPSettings != nil {
+		if ds.XHTTPSettings.Path != "" {
+			download.Path = ds.XHTTPSettings.Path
+		}
+		if ds.XHTTPSettings.Host != "" {
+			download.Host = ds.XHTTPSettings.Host
+		}
+	}
+	switch ds.Security {
+	case "tls":
+		download.TLS = true
+		if ds.TLSSettings != nil {
+			download.ServerName = ds.TLSSettings.ServerName
+			download.ALPN = ds.TLSSettings.Alpn
+			download.ClientFingerprint = ds.TLSSettings.Fingerprint
+		}
+	case "reality":
+		download.TLS = true
+		if rs := ds.RealitySettings; rs != nil {
+			download.ServerName = rs.ServerName
+			download.ClientFingerprint = rs.Fingerprint
+			publicKey := rs.Password
+			if publicKey == "" {
+				publicKey = rs.PublicKey
+			}
+			download.RealityOpts = &clashRealityOpts{PublicKey: publicKey, ShortID: rs.ShortID}
+		}
+	}
+	opts.DownloadSettings = download
+	return opts, nil
+}
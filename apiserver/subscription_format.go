@@ -0,0 +1,164 @@
+package apiserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Output formats of GET /subscription, selected with the `format` query parameter.
+const (
+	subscriptionFormatJSON    = "json"    // JSON envelope with the list of links (default)
+	subscriptionFormatRaw     = "raw"     // newline-separated links
+	subscriptionFormatBase64  = "base64"  // base64 of the newline-separated links, as read by v2rayN
+	subscriptionFormatClash   = "clash"   // Clash.Meta (mihomo) YAML configuration
+	subscriptionFormatSingbox = "singbox" // sing-box JSON configuration
+	subscriptionFormatXray    = "xray"    // Xray JSON configuration
+)
+
+// subscriptionFormats lists the accepted subscription formats.
+var subscriptionFormats = []string{subscriptionFormatJSON, subscriptionFormatRaw, subscriptionFormatBase64, subscriptionFormatClash, subscriptionFormatSingbox, subscriptionFormatXray}
+
+// isSubscriptionFormat reports whether format is a supported subscription format; empty means JSON.
+func isSubscriptionFormat(format string) bool {
+	if format == "" {
+		return true
+	}
+	for _, f := range subscriptionFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptionConfigRenderers render the formats that are a whole client configuration.
+var subscriptionConfigRenderers = map[string]struct {
+	name        string
+	contentType string
+	render      func(opts SubscriptionOptions, nodes []subscriptionNode) ([]byte, error)
+}{
+	subscriptionFormatClash:   {"Clash", "text/yaml; charset=utf-8", renderClashConfig},
+	subscriptionFormatSingbox: {"sing-box", "application/json", renderSingboxConfig},
+	subscriptionFormatXray:    {"Xray", "application/json", renderXrayConfig},
+}
+
+// SubscriptionOptions configures what GET /subscription returns besides the nodes.
+type SubscriptionOptions struct {
+	// UpdateInterval is the update interval suggested to clients, in hours.
+	UpdateInterval int
+	// Name is the profile name clients show for the subscription.
+	Name string
+	// ClashTemplate is the Clash.Meta configuration the clash format is built on; empty means the
+	// built-in template.
+	ClashTemplate string
+	// SingboxTemplate is the sing-box configuration the singbox format is built on; empty means the
+	// built-in template.
+	SingboxTemplate string
+	// XrayTemplate is the Xray configuration the xray format is built on; empty means the built-in
+	// template.
+	XrayTemplate string
+}
+
+// writeSubscription writes the subscription nodes in the requested format.
+func (s *APIServer) writeSubscription(w http.ResponseWriter, format string, nodes []subscriptionNode) {
+	if renderer, ok := subscriptionConfigRenderers[format]; ok {
+		config, err := renderer.render(s.subsOptions, nodes)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to render %s configuration: %v", renderer.name, err))
+			return
+		}
+		w.Header().Set("Content-Type", renderer.contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(config)
+		return
+	}
+
+	links := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		links = append(links, node.shareLink())
+	}
+
+	switch format {
+	case subscriptionFormatRaw:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(strings.Join(links, "\n")))
+	case subscriptionFormatBase64:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n")))))
+	default:
+		RespondWithJSON(w, http.StatusOK, JSONSuccessResponse{Success: true, Data: links})
+	}
+}
+
+// setSubscriptionHeaders sets the headers subscription clients read alongside the links:
+// Subscription-Userinfo with the traffic, quota and expiry of the matched users,
+// Profile-Update-Interval and Content-Disposition.
+func (s *APIServer) setSubscriptionHeaders(w http.ResponseWriter, r *http.Request, emails []string) {
+	if userinfo := s.subscriptionUserinfo(r, emails); userinfo != "" {
+		w.Header().Set("Subscription-Userinfo", userinfo)
+	}
+
+	w.Header().Set("Profile-Update-Interval", strconv.Itoa(s.subsOptions.UpdateInterval))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": s.subsOptions.Name}))
+}
+
+// subscriptionUserinfo builds the Subscription-Userinfo header value from the quotas, traffic
+// counters and expiry dates of the given users. Upload and download are the quota usage of users
+// with a quota and the counters of the others. The total is only set when every user has a quota,
+// and the expiry is the earliest among the users.
+func (s *APIServer) subscriptionUserinfo(r *http.Request, emails []string) string {
+	if len(emails) == 0 {
+		return ""
+	}
+
+	// Read a single user's counters directly, everyone's at once otherwise
+	queryEmail := ""
+	if len(emails) == 1 {
+		queryEmail = emails[0]
+	}
+	traffic, err := s.queryUserTraffic(r.Context(), queryEmail, false)
+	if err != nil {
+		log.Printf("Warning: failed to read user traffic for subscription: %v", err)
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	var upload, download, total, expire int64
+	limited := true
+	for _, email := range emails {
+		// Users with a quota report the usage it is enforced on, which outlives counter resets;
+		// the others report the raw counters
+		if q, ok := s.store.Quotas.Get(email); ok {
+			uplink, downlink := s.quotaUsage(q, traffic[email])
+			upload += uplink
+			download += downlink
+			total += q.Limit
+		} else {
+			upload += traffic[email].Uplink
+			download += traffic[email].Downlink
+			limited = false
+		}
+		if e, ok := s.store.Expiries.Get(email); ok {
+			if at := e.ExpireAt.Unix(); expire == 0 || at < expire {
+				expire = at
+			}
+		}
+	}
+	if !limited {
+		total = 0
+	}
+
+	userinfo := fmt.Sprintf("upload=%d; download=%d; total=%d", upload, download, total)
+	if expire != 0 {
+		userinfo += fmt.Sprintf("; expire=%d", expire)
+	}
+	return userinfo
+}
@@ -0,0 +1,183 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// subscriptionClient is a client of an inbound, as read by the subscription adapter of its protocol.
+type subscriptionClient struct {
+	ID       string `json:"id"`
+	Password string `json:"password"` // trojan, shadowsocks
+	Method   string `json:"method"`   // shadowsocks
+	Email    string `json:"email"`
+	Flow     string `json:"flow"`
+	Level    int64  `json:"level"`
+	// ServerKey is the key of a Shadowsocks 2022 multi-user inbound, which clients send
+	// along with their own key.
+	ServerKey string `json:"-"`
+}
+
+// decodeSubscriptionClients reads the clients list of inbound settings, which holds the
+// credentials of every client for protocols with per-client accounts.
+func decodeSubscriptionClients(settings json.RawMessage) ([]subscriptionClient, error) {
+	var config struct {
+		Clients []subscriptionClient `json:"clients"`
+	}
+	if err := json.Unmarshal(settings, &config); err != nil {
+		return nil, err
+	}
+	return config.Clients, nil
+}
+
+// subscriptionNode is one proxy of a subscription: a profile resolved against the inbound it
+// matches and one of the requested clients. Every subscription format is rendered from nodes.
+type subscriptionNode struct {
+	Name       string
+	Protocol   string // vless, vmess, trojan or shadowsocks
+	Address    string
+	Port       uint16
+	ID         string // vless, vmess
+	Password   string // trojan, shadowsocks; "serverKey:userKey" for Shadowsocks 2022 multi-user inbounds
+	Method     string // shadowsocks
+	Encryption string // vless encryption, or vmess security
+	Flow       string
+	Network    string // raw, xhttp, http, ws, httpupgrade, grpc or kcp
+	Security   string // none, tls or reality
+	LinkStyle  string // vmess share link style, see vmessLinkStyleURL
+
+	// Transport
+	Host        string
+	Path        string
+	Mode        string
+	Extra       map[string]interface{} // xhttp extra, with the REALITY fields of downloadSettings filled in
+	ServiceName string
+	HeaderType  string
+	Seed        string
+
+	// TLS and REALITY
+	Fingerprint   string
+	ServerName    string
+	Alpn          []string
+	EchConfigList string
+	PublicKey     string
+	ShortID       string
+	SpiderX       string
+	Mldsa65Verify string
+}
+
+// shareLink encodes the node as a share link of its protocol.
+func (n subscriptionNode) shareLink() string {
+	adapter, ok := subscriptionAdapterOf(n.Protocol)
+	if !ok {
+		return ""
+	}
+	return adapter.ShareLink(n)
+}
+
+// urlShareLink encodes the node as a VLESS-style share link, as used by vless, trojan and vmess
+// with the "url" link style. The encryption parameter is left out when empty.
+func (n subscriptionNode) urlShareLink(credential, encryption string) string {
+	baseURL := fmt.Sprintf("%s://%s@%s:%d", n.Protocol, credential, n.Address, n.Port)
+	queryParams := url.Values{}
+
+	if n.Network != "raw" {
+		queryParams.Add("type", n.Network)
+	}
+
+	if encryption != "" {
+		queryParams.Add("encryption", encryption)
+	}
+
+	if n.Security != "none" {
+		queryParams.Add("security", n.Security)
+	}
+
+	switch n.Network {
+	case "xhttp":
+		queryParams.Add("host", url.QueryEscape(n.Host))
+		if n.Path != "" {
+			queryParams.Add("path", url.QueryEscape(n.Path))
+		}
+		queryParams.Add("mode", n.Mode)
+		if n.Extra != nil {
+			extraBytes, _ := json.Marshal(n.Extra)
+			queryParams.Add("extra", url.QueryEscape(string(extraBytes)))
+		}
+	case "http", "ws", "httpupgrade":
+		queryParams.Add("host", url.QueryEscape(n.Host))
+		if n.Path != "" && n.Path != "/" {
+			queryParams.Add("path", url.QueryEscape(n.Path))
+		}
+	case "grpc":
+		if n.ServiceName != "" {
+			queryParams.Add("serviceName", url.QueryEscape(n.ServiceName))
+		}
+		if n.Mode != "" {
+			queryParams.Add("mode", n.Mode)
+		}
+	case "kcp":
+		if n.HeaderType != "" {
+			queryParams.Add("headerType", n.HeaderType)
+		}
+		if n.Seed != "" {
+			queryParams.Add("seed", url.QueryEscape(n.Seed))
+		}
+	}
+
+	switch n.Security {
+	case "tls":
+		if n.Fingerprint != "" {
+			queryParams.Add("fp", n.Fingerprint)
+		}
+		if n.ServerName != "" {
+			queryParams.Add("sni", n.ServerName)
+		}
+		if len(n.Alpn) > 0 {
+			queryParams.Add("alpn", url.QueryEscape(strings.Join(n.Alpn, ",")))
+		}
+		if n.EchConfigList != "" {
+			queryParams.Add("ech", url.QueryEscape(n.EchConfigList))
+		}
+	case "reality":
+		queryParams.Add("fp", n.Fingerprint)
+		if n.ServerName != "" {
+			queryParams.Add("sni", n.ServerName)
+		}
+		if n.Flow != "" {
+			queryParams.Add("flow", n.Flow)
+		}
+		queryParams.Add("pbk", n.PublicKey)
+		if n.Mldsa65Verify != "" {
+			queryParams.Add("pqv", url.QueryEscape(n.Mldsa65Verify))
+		}
+		if n.ShortID != "" {
+			queryParams.Add("sid", n.ShortID)
+		}
+		queryParams.Add("spx", url.QueryEscape(n.SpiderX))
+	}
+
+	finalURL := baseURL
+	if encodedQuery := queryParams.Encode(); encodedQuery != "" {
+		finalURL += "?" + encodedQuery
+	}
+	return finalURL + "#" + url.QueryEscape(n.Name)
+}
+
+// uniqueNodeNames returns the node names, numbering repeated ones ("name 2", "name 3", ...)
+// for formats that identify proxies by name.
+func uniqueNodeNames(nodes []subscriptionNode) []string {
+	names := make([]string, len(nodes))
+	used := make(map[string]bool, len(nodes))
+	for i, node := range nodes {
+		name := node.Name
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s %d", node.Name, n)
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
@@ -0,0 +1,322 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	jsonconf "github.com/xtls/xray-core/infra/conf/json"
+)
+
+// Values accepted in the fields of a subscription profile.
+var (
+	subscriptionNetworks   = []string{"raw", "tcp", "xhttp", "http", "ws", "httpupgrade", "grpc", "kcp"}
+	subscriptionSecurities = []string{"", "none", "tls", "reality"}
+	xhttpModes             = []string{"", "auto", "packet-up", "stream-up", "stream-one"}
+	grpcModes              = []string{"", "gun", "multi"}
+)
+
+// containsString reports whether value is one of values.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSubscriptionProfile checks a profile before it is used, so that a broken profile is
+// rejected when it is submitted, and skipped with a warning when it is loaded from the file.
+func validateSubscriptionProfile(p SubscriptionProfile) error {
+	if !isSubscriptionProtocol(p.Protocol) {
+		return fmt.Errorf("unsupported protocol '%s', expected one of: %v", p.Protocol, subscriptionProtocols())
+	}
+	if p.Address == "" {
+		return fmt.Errorf("address is required")
+	}
+	if !containsString(subscriptionNetworks, p.Network) {
+		return fmt.Errorf("unsupported network '%s', expected one of: %v", p.Network, subscriptionNetworks)
+	}
+	if !containsString(subscriptionSecurities, p.Security) {
+		return fmt.Errorf("unsupported security '%s', expected none, tls or reality", p.Security)
+	}
+	if p.Security == "reality" && p.Password == "" {
+		return fmt.Errorf("password (the REALITY public key) is required when security is reality")
+	}
+	if p.Level < -1 {
+		return fmt.Errorf("level must be -1 (any level) or a user level")
+	}
+	switch p.Network {
+	case "xhttp":
+		if !containsString(xhttpModes, p.Mode) {
+			return fmt.Errorf("unsupported xhttp mode '%s', expected one of: %v", p.Mode, xhttpModes[1:])
+		}
+	case "grpc":
+		if !containsString(grpcModes, p.Mode) {
+			return fmt.Errorf("unsupported grpc mode '%s', expected one of: %v", p.Mode, grpcModes[1:])
+		}
+	}
+	if len(p.Extra) > 0 && string(p.Extra) != "null" {
+		var extra map[string]interface{}
+		if err := json.Unmarshal(p.Extra, &extra); err != nil {
+			return fmt.Errorf("extra must be a JSON object: %w", err)
+		}
+	}
+	if p.LinkStyle != "" && (p.Protocol != "vmess" || p.LinkStyle != vmessLinkStyleURL) {
+		return fmt.Errorf("linkStyle can only be set to '%s' on vmess profiles", vmessLinkStyleURL)
+	}
+	return nil
+}
+
+// profilesChangedError is returned by profile updates whose If-Match does not match the current
+// entity tag of the profiles.
+type profilesChangedError string
+
+func (e profilesChangedError) Error() string {
+	return fmt.Sprintf("Subscription profiles have changed, their current ETag is %s", string(e))
+}
+
+// subscriptionProfileSet keeps the subscription profiles of the file at XRAY_API_BRIDGE_SUBS_CONFIG
+// in memory. It reloads the file when it changes on disk, and writes changes made through the API
+// back to it. Profiles of the file that fail validation are kept, so that writing the file back
+// does not drop them, but are left out of subscriptions.
+type subscriptionProfileSet struct {
+	mu       sync.RWMutex
+	path     string
+	profiles []SubscriptionProfile
+	etag     string // entity tag of profiles, changing whenever they do
+	loadErr  error  // why the file could not be loaded, while no profiles are held
+	modTime  time.Time
+	size     int64
+}
+
+func newSubscriptionProfileSet(path string) *subscriptionProfileSet {
+	p := &subscriptionProfileSet{path: path}
+	if path == "" {
+		p.loadErr = fmt.Errorf("subscription config path is not provided (XRAY_API_BRIDGE_SUBS_CONFIG)")
+		return p
+	}
+	if _, err := p.reload(); err != nil {
+		log.Printf("Warning: failed to load subscription profiles: %v", err)
+	}
+	return p
+}
+
+// List returns a copy of the profiles, including the invalid ones, along with their entity tag.
+func (p *subscriptionProfileSet) List() ([]SubscriptionProfile, string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.profiles == nil && p.loadErr != nil {
+		return nil, "", p.loadErr
+	}
+	return append([]SubscriptionProfile(nil), p.profiles...), p.etag, nil
+}
+
+// Valid returns the profiles that pass validation, which are the ones subscriptions are built from.
+func (p *subscriptionProfileSet) Valid() ([]SubscriptionProfile, error) {
+	profiles, _, err := p.List()
+	if err != nil {
+		return nil, err
+	}
+	valid := profiles[:0]
+	for _, profile := range profiles {
+		if validateSubscriptionProfile(profile) == nil {
+			valid = append(valid, profile)
+		}
+	}
+	return valid, nil
+}
+
+// Update applies fn to a copy of the profiles and writes the result to the file. Profiles are
+// validated by the callers, as the ones of the file that fail validation are written back as they
+// are. A non-empty ifMatch must match the current entity tag, so that profiles addressed by index
+// are not the wrong ones after a concurrent change. The profiles held in memory only change once
+// the file is written; they are returned along with their new entity tag.
+func (p *subscriptionProfileSet) Update(ifMatch string, fn func([]SubscriptionProfile) ([]SubscriptionProfile, error)) ([]SubscriptionProfile, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.path == "" {
+		return nil, "", p.loadErr
+	}
+	if p.profiles == nil && p.loadErr != nil {
+		// Do not overwrite a file that exists but could not be loaded
+		if _, err := os.Stat(p.path); err == nil {
+			return nil, "", p.loadErr
+		}
+	}
+	if ifMatch != "" && !etagMatches(ifMatch, p.currentETag()) {
+		return nil, "", profilesChangedError(p.currentETag())
+	}
+
+	profiles, err := fn(append([]SubscriptionProfile(nil), p.profiles...))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := writeSubscriptionProfiles(p.path, profiles); err != nil {
+		return nil, "", err
+	}
+	if info, err := os.Stat(p.path); err == nil {
+		p.modTime, p.size = info.ModTime(), info.Size()
+	}
+	p.profiles = profiles
+	p.etag = subscriptionProfilesETag(profiles)
+	p.loadErr = nil
+	return append([]SubscriptionProfile(nil), profiles...), p.etag, nil
+}
+
+// currentETag returns the entity tag of the profiles held, which is that of an empty list while
+// none are.
+func (p *subscriptionProfileSet) currentETag() string {
+	if p.etag == "" {
+		return subscriptionProfilesETag(nil)
+	}
+	return p.etag
+}
+
+// subscriptionProfilesETag returns the strong entity tag of a list of profiles, a hash of their
+// JSON encoding.
+func subscriptionProfilesETag(profiles []SubscriptionProfile) string {
+	if profiles == nil {
+		profiles = []SubscriptionProfile{}
+	}
+	data, _ := json.Marshal(profiles)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-Match header value, a list of entity tags or "*", matches etag.
+func etagMatches(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads the file again if it changed since it was last read. A file that fails to load
+// leaves the previous profiles in place.
+func (p *subscriptionProfileSet) reload() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		if p.profiles == nil {
+			p.loadErr = fmt.Errorf("could not open subscription config file %s: %w", p.path, err)
+		}
+		return false, err
+	}
+	if info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return false, nil
+	}
+	p.modTime, p.size = info.ModTime(), info.Size()
+
+	profiles, err := loadSubscriptionProfiles(p.path)
+	if err != nil {
+		if p.profiles == nil {
+			p.loadErr = err
+		}
+		return false, err
+	}
+	if profiles == nil {
+		profiles = []SubscriptionProfile{}
+	}
+	p.profiles = profiles
+	p.etag = subscriptionProfilesETag(profiles)
+	p.loadErr = nil
+	return true, nil
+}
+
+// RunSubscriptionProfileWatcher reloads the subscription profiles whenever their file changes on
+// disk, checking every interval until ctx is cancelled.
+func (s *APIServer) RunSubscriptionProfileWatcher(ctx context.Context, interval time.Duration) {
+	if s.subsProfiles.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.subsProfiles.reload()
+			if err != nil {
+				log.Printf("Warning: failed to reload subscription profiles, keeping the previous ones: %v", err)
+			} else if reloaded {
+				log.Printf("Subscription profiles reloaded from %s", s.subsProfiles.path)
+			}
+		}
+	}
+}
+
+// loadSubscriptionProfiles loads the subscription profiles from a JSONC file. The file is decoded
+// leniently: unknown fields are ignored, and profiles that fail validation are logged and kept, to
+// be skipped when generating subscriptions. Only a file that cannot be decoded is rejected.
+func loadSubscriptionProfiles(path string) ([]SubscriptionProfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open subscription config file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	// Use a JSONC-compatible reader
+	jsoncReader := &jsonconf.Reader{Reader: file}
+
+	var profiles []SubscriptionProfile
+	if err := json.NewDecoder(jsoncReader).Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("could not decode subscription config file %s: %w", path, err)
+	}
+	for i, profile := range profiles {
+		if err := validateSubscriptionProfile(profile); err != nil {
+			log.Printf("Warning: skipping invalid profile %d in subscription config file %s: %v", i, path, err)
+		}
+	}
+
+	return profiles, nil
+}
+
+// writeSubscriptionProfiles atomically replaces the subscription config file. Comments of a JSONC
+// file are not kept.
+func writeSubscriptionProfiles(path string, profiles []SubscriptionProfile) error {
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode subscription profiles: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// Keep the permissions of the file being replaced
+	if info, err := os.Stat(path); err == nil {
+		tmp.Chmod(info.Mode().Perm())
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	jsonconf "github.com/xtls/xray-core/infra/conf/json"
+)
+
+// Tags of the outbound groups put in front of the generated sing-box outbounds.
+const (
+	singboxSelectorTag = "proxy"
+	singboxURLTestTag  = "auto"
+)
+
+// defaultSingboxTemplate is used when XRAY_API_BRIDGE_SUBS_SINGBOX_TEMPLATE is not set.
+const defaultSingboxTemplate = `{
+  "log": { "level": "info" },
+  "inbounds": [
+    { "type": "mixed", "tag": "mixed-in", "listen": "127.0.0.1", "listen_port": 2080 }
+  ],
+  "outbounds": [
+    { "type": "direct", "tag": "direct" }
+  ],
+  "route": {
+    "rules": [
+      { "ip_is_private": true, "outbound": "direct" }
+    ],
+    "final": "proxy",
+    "auto_detect_interface": true
+  }
+}`
+
+type singboxOutbound struct {
+	Type           string            `json:"type"`
+	Tag            string            `json:"tag"`
+	Server         string            `json:"server,omitempty"`
+	ServerPort     uint16            `json:"server_port,omitempty"`
+	UUID           string            `json:"uuid,omitempty"`
+	Password       string            `json:"password,omitempty"`
+	Method         string            `json:"method,omitempty"`
+	Flow           string            `json:"flow,omitempty"`
+	Security       string            `json:"security,omitempty"`
+	AlterID        *int              `json:"alter_id,omitempty"`
+	PacketEncoding string            `json:"packet_encoding,omitempty"`
+	TLS            *singboxTLS       `json:"tls,omitempty"`
+	Transport      *singboxTransport `json:"transport,omitempty"`
+
+	// Groups
+	Outbounds []string `json:"outbounds,omitempty"`
+	Default   string   `json:"default,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Interval  string   `json:"interval,omitempty"`
+}
+
+type singboxTLS struct {
+	Enabled    bool            `json:"enabled"`
+	ServerName string          `json:"server_name,omitempty"`
+	ALPN       []string        `json:"alpn,omitempty"`
+	UTLS       *singboxUTLS    `json:"utls,omitempty"`
+	ECH        *singboxECH     `json:"ech,omitempty"`
+	Reality    *singboxReality `json:"reality,omitempty"`
+}
+
+type singboxUTLS struct {
+	Enabled     bool   `json:"enabled"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+type singboxECH struct {
+	Enabled bool     `json:"enabled"`
+	Config  []string `json:"config,omitempty"`
+}
+
+type singboxReality struct {
+	Enabled   bool   `json:"enabled"`
+	PublicKey string `json:"public_key"`
+	ShortID   string `json:"short_id,omitempty"`
+}
+
+type singboxTransport struct {
+	Type        string            `json:"type"`
+	Host        interface{}       `json:"host,omitempty"` // a list for http, a string for httpupgrade
+	Path        string            `json:"path,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"service_name,omitempty"`
+}
+
+// renderSingboxConfig renders the nodes as a sing-box client configuration, built on the template
+// at opts.SingboxTemplate. The generated outbounds, led by a selector and a urltest group, are
+// put before the outbounds of the template.
+func renderSingboxConfig(opts SubscriptionOptions, nodes []subscriptionNode) ([]byte, error) {
+	config, err := loadSingboxTemplate(opts.SingboxTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	names := uniqueNodeNames(nodes)
+	var proxies []interface{}
+	var tags []string
+	for i, node := range nodes {
+		outbound, err := newSingboxOutbound(node, names[i])
+		if err != nil {
+			log.Printf("Warning: skipping subscription node %s for sing-box: %v", names[i], err)
+			continue
+		}
+		proxies = append(proxies, outbound)
+		tags = append(tags, outbound.Tag)
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("none of the subscription nodes can be expressed as a sing-box outbound")
+	}
+
+	outbounds := []interface{}{
+		singboxOutbound{
+			Type:      "selector",
+			Tag:       singboxSelectorTag,
+			Outbounds: append([]string{singboxURLTestTag}, tags...),
+			Default:   singboxURLTestTag,
+		},
+		singboxOutbound{
+			Type:      "urltest",
+			Tag:       singboxURLTestTag,
+			Outbounds: tags,
+			URL:       "https://www.gstatic.com/generate_204",
+			Interval:  "5m",
+		},
+	}
+	outbounds = append(outbounds, proxies...)
+	if existing, ok := config["outbounds"].([]interface{}); ok {
+		outbounds = append(outbounds, existing...)
+	}
+	config["outbounds"] = outbounds
+
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// loadSingboxTemplate reads the JSONC sing-box configuration template, or the built-in one when
+// path is empty.
+func loadSingboxTemplate(path string) (map[string]interface{}, error) {
+	data := []byte(defaultSingboxTemplate)
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("could not read sing-box template %s: %w", path, err)
+		}
+	}
+
+	var config map[string]interface{}
+	decoder := json.NewDecoder(&jsonconf.Reader{Reader: bytes.NewReader(data)})
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("could not decode sing-box template %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// newSingboxOutbound converts a subscription node into a sing-box outbound. The subscription
+// adapter of the node's protocol sets the protocol fields.
+func newSingboxOutbound(node subscriptionNode, tag string) (singboxOutbound, error) {
+	adapter, ok := subscriptionAdapterOf(node.Protocol)
+	if !ok {
+		return singboxOutbound{}, fmt.Errorf("unsupported protocol '%s'", node.Protocol)
+	}
+	outbound := singboxOutbound{
+		Type:       node.Protocol,
+		Tag:        tag,
+		Server:     node.Address,
+		ServerPort: node.Port,
+	}
+	streamSettings, err := adapter.SingboxOutbound(node, &outbound)
+	if err != nil {
+		return singboxOutbound{}, err
+	}
+	if !streamSettings {
+		return outbound, nil
+	}
+
+	switch node.Network {
+	case "raw":
+	case "ws":
+		outbound.Transport = &singboxTransport{Type: "ws", Path: node.Path, Headers: map[string]string{"Host": node.Host}}
+	case "httpupgrade":
+		outbound.Transport = &singboxTransport{Type: "httpupgrade", Host: node.Host, Path: node.Path}
+	case "http":
+		outbound.Transport = &singboxTransport{Type: "http", Host: strings.Split(node.Host, ","), Path: node.Path}
+	case "grpc":
+		outbound.Transport = &singboxTransport{Type: "grpc", ServiceName: node.ServiceName}
+	default:
+		return singboxOutbound{}, fmt.Errorf("unsupported network '%s'", node.Network)
+	}
+
+	switch node.Security {
+	case "tls":
+		outbound.TLS = &singboxTLS{
+			Enabled:    true,
+			ServerName: node.ServerName,
+			ALPN:       node.Alpn,
+		}
+		if node.Fingerprint != "" {
+			outbound.TLS.UTLS = &singboxUTLS{Enabled: true, Fingerprint: node.Fingerprint}
+		}
+		if node.EchConfigList != "" {
+			outbound.TLS.ECH = &singboxECH{Enabled: true}
+			// A DNS query (e.g. "example.com+https://1.1.1.1/dns-query") is left to the client
+			if !strings.Contains(node.EchConfigList, "://") {
+				outbound.TLS.ECH.Config = []string{"-----BEGIN ECH CONFIGS-----", node.EchConfigList, "-----END ECH CONFIGS-----"}
+			}
+		}
+	case "reality":
+		outbound.TLS = &singboxTLS{
+			Enabled:    true,
+			ServerName: node.ServerName,
+			UTLS:       &singboxUTLS{Enabled: true, Fingerprint: node.Fingerprint},
+			Reality:    &singboxReality{Enabled: true, PublicKey: node.PublicKey, ShortID: node.ShortID},
+		}
+	}
+	return outbound, nil
+}
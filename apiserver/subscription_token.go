@@ -0,0 +1,78 @@
+package apiserver
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"xray-api-bridge/store"
+)
+
+// subscriptionTokenBytes is the number of random bytes in a subscription token.
+const subscriptionTokenBytes = 24
+
+// newSubscriptionToken generates a random, URL-safe subscription token.
+func newSubscriptionToken() (string, error) {
+	b := make([]byte, subscriptionTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate subscription token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// issueSubscriptionToken gives a user a new subscription token, replacing (and so revoking) the
+// previous one if any.
+func (s *APIServer) issueSubscriptionToken(email string) (store.SubscriptionToken, error) {
+	token, err := newSubscriptionToken()
+	if err != nil {
+		return store.SubscriptionToken{}, err
+	}
+	t := store.SubscriptionToken{
+		Email:     email,
+		Token:     token,
+		CreatedAt: time.Now(),
+	}
+	if err := s.store.SubscriptionTokens.Put(t); err != nil {
+		return store.SubscriptionToken{}, err
+	}
+	return t, nil
+}
+
+// isAdminRequest reports whether the request carries the admin key as a bearer token.
+func (s *APIServer) isAdminRequest(r *http.Request) bool {
+	if s.adminKey == "" {
+		return false
+	}
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(key), []byte(s.adminKey)) == 1
+}
+
+// requireAdmin rejects requests that do not carry the admin key. Admin endpoints are disabled
+// altogether when no admin key is configured.
+func (s *APIServer) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminKey == "" {
+			RespondWithError(w, http.StatusForbidden, "Admin endpoints are disabled, set XRAY_API_BRIDGE_SUBS_SUPERKEY to enable them.")
+			return
+		}
+		if !s.isAdminRequest(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			RespondWithError(w, http.StatusUnauthorized, "A valid admin key is required.")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func newSubscriptionTokenResponse(t store.SubscriptionToken) SubscriptionTokenResponse {
+	return SubscriptionTokenResponse{
+		Email:     t.Email,
+		Token:     t.Token,
+		URL:       "/subscription/" + t.Token,
+		CreatedAt: t.CreatedAt,
+	}
+}
@@ -0,0 +1,230 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xtls/xray-core/infra/conf"
+	jsonconf "github.com/xtls/xray-core/infra/conf/json"
+)
+
+// xrayBalancerTag is the balancer spreading the routed traffic over the generated outbounds.
+const xrayBalancerTag = "proxy"
+
+// defaultXrayTemplate is used when XRAY_API_BRIDGE_SUBS_XRAY_TEMPLATE is not set. Its routing only
+// relies on IP ranges, so the generated configuration validates without geoip.dat and geosite.dat.
+const defaultXrayTemplate = `{
+  "log": { "loglevel": "warning" },
+  "dns": {
+    "servers": ["https+local://1.1.1.1/dns-query", "localhost"]
+  },
+  "inbounds": [
+    {
+      "tag": "socks-in",
+      "listen": "127.0.0.1",
+      "port": 10808,
+      "protocol": "socks",
+      "settings": { "udp": true },
+      "sniffing": { "enabled": true, "destOverride": ["http", "tls", "quic"] }
+    },
+    {
+      "tag": "http-in",
+      "listen": "127.0.0.1",
+      "port": 10809,
+      "protocol": "http",
+      "sniffing": { "enabled": true, "destOverride": ["http", "tls"] }
+    }
+  ],
+  "outbounds": [
+    { "tag": "direct", "protocol": "freedom" },
+    { "tag": "block", "protocol": "blackhole" }
+  ],
+  "routing": {
+    "domainStrategy": "IPIfNonMatch",
+    "rules": [
+      {
+        "ip": ["10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "169.254.0.0/16", "fc00::/7", "fe80::/10", "::1/128"],
+        "outboundTag": "direct"
+      },
+      { "network": "tcp,udp", "balancerTag": "proxy" }
+    ]
+  }
+}`
+
+// renderXrayConfig renders the nodes as an Xray client configuration, built on the template at
+// opts.XrayTemplate. The generated outbounds are put before the outbounds of the template and
+// grouped by the "proxy" balancer, which picks the one with the lowest latency.
+// The result is validated by building it the way Xray-core would load it.
+func renderXrayConfig(opts SubscriptionOptions, nodes []subscriptionNode) ([]byte, error) {
+	config, err := loadXrayTemplate(opts.XrayTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	names := uniqueNodeNames(nodes)
+	outbounds := make([]interface{}, 0, len(nodes))
+	for i, node := range nodes {
+		outbound, err := newXrayOutbound(node, names[i])
+		if err != nil {
+			return nil, err
+		}
+		outbounds = append(outbounds, outbound)
+	}
+	if existing, ok := config["outbounds"].([]interface{}); ok {
+		outbounds = append(outbounds, existing...)
+	}
+	config["outbounds"] = outbounds
+
+	if _, ok := config["observatory"]; !ok {
+		config["observatory"] = map[string]interface{}{
+			"subjectSelector": names,
+			"probeUrl":        "https://www.gstatic.com/generate_204",
+			"probeInterval":   "5m",
+		}
+	}
+	routing, _ := config["routing"].(map[string]interface{})
+	if routing == nil {
+		routing = make(map[string]interface{})
+		config["routing"] = routing
+	}
+	balancers, _ := routing["balancers"].([]interface{})
+	routing["balancers"] = append(balancers, map[string]interface{}{
+		"tag":      xrayBalancerTag,
+		"selector": names,
+		"strategy": map[string]interface{}{"type": "leastPing"},
+	})
+
+	output, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not encode Xray configuration: %w", err)
+	}
+
+	var built conf.Config
+	if err := json.Unmarshal(output, &built); err != nil {
+		return nil, fmt.Errorf("generated Xray configuration is invalid: %w", err)
+	}
+	if _, err := built.Build(); err != nil {
+		return nil, fmt.Errorf("generated Xray configuration is invalid: %w", err)
+	}
+	return output, nil
+}
+
+// xrayVnextSettings returns the settings of an outbound listing the user under its server, with
+// the given account fields besides the id, as VLESS and VMess outbounds do.
+func xrayVnextSettings(node subscriptionNode, user map[string]interface{}) map[string]interface{} {
+	user["id"] = node.ID
+	server := map[string]interface{}{"address": node.Address, "port": node.Port, "users": []interface{}{user}}
+	return map[string]interface{}{"vnext": []interface{}{server}}
+}
+
+// xrayServersSettings returns the settings of an outbound holding the credentials on the server,
+// as Trojan and Shadowsocks outbounds do.
+func xrayServersSettings(node subscriptionNode, credentials map[string]interface{}) map[string]interface{} {
+	credentials["address"] = node.Address
+	credentials["port"] = node.Port
+	return map[string]interface{}{"servers": []interface{}{credentials}}
+}
+
+// loadXrayTemplate reads the JSONC Xray configuration template, or the built-in one when path is empty.
+func loadXrayTemplate(path string) (map[string]interface{}, error) {
+	data := []byte(defaultXrayTemplate)
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("could not read Xray template %s: %w", path, err)
+		}
+	}
+
+	var config map[string]interface{}
+	decoder := json.NewDecoder(&jsonconf.Reader{Reader: bytes.NewReader(data)})
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("could not decode Xray template %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// newXrayOutbound converts a subscription node into an Xray outbound, in configuration file form.
+// The subscription adapter of the node's protocol builds the settings.
+func newXrayOutbound(node subscriptionNode, tag string) (map[string]interface{}, error) {
+	adapter, ok := subscriptionAdapterOf(node.Protocol)
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol '%s'", node.Protocol)
+	}
+	settings := adapter.XrayOutboundSettings(node)
+
+	network := node.Network
+	streamSettings := map[string]interface{}{
+		"network":  network,
+		"security": node.Security,
+	}
+	switch network {
+	case "xhttp":
+		xhttpSettings := map[string]interface{}{"host": node.Host, "mode": node.Mode}
+		if node.Path != "" {
+			xhttpSettings["path"] = node.Path
+		}
+		if node.Extra != nil {
+			xhttpSettings["extra"] = node.Extra
+		}
+		streamSettings["xhttpSettings"] = xhttpSettings
+	case "ws", "httpupgrade":
+		streamSettings[network+"Settings"] = map[string]interface{}{"host": node.Host, "path": node.Path}
+	case "http":
+		streamSettings["httpSettings"] = map[string]interface{}{"host": strings.Split(node.Host, ","), "path": node.Path}
+	case "grpc":
+		streamSettings["grpcSettings"] = map[string]interface{}{"serviceName": node.ServiceName, "multiMode": node.Mode == "multi"}
+	case "kcp":
+		kcpSettings := map[string]interface{}{}
+		if node.HeaderType != "" {
+			kcpSettings["header"] = map[string]interface{}{"type": node.HeaderType}
+		}
+		if node.Seed != "" {
+			kcpSettings["seed"] = node.Seed
+		}
+		streamSettings["kcpSettings"] = kcpSettings
+	}
+
+	switch node.Security {
+	case "tls":
+		tlsSettings := map[string]interface{}{}
+		if node.ServerName != "" {
+			tlsSettings["serverName"] = node.ServerName
+		}
+		if len(node.Alpn) > 0 {
+			tlsSettings["alpn"] = node.Alpn
+		}
+		if node.Fingerprint != "" {
+			tlsSettings["fingerprint"] = node.Fingerprint
+		}
+		if node.EchConfigList != "" {
+			tlsSettings["echConfigList"] = node.EchConfigList
+		}
+		streamSettings["tlsSettings"] = tlsSettings
+	case "reality":
+		realitySettings := map[string]interface{}{
+			"fingerprint": node.Fingerprint,
+			"password":    node.PublicKey,
+			"spiderX":     node.SpiderX,
+		}
+		if node.ServerName != "" {
+			realitySettings["serverName"] = node.ServerName
+		}
+		if node.ShortID != "" {
+			realitySettings["shortId"] = node.ShortID
+		}
+		if node.Mldsa65Verify != "" {
+			realitySettings["mldsa65Verify"] = node.Mldsa65Verify
+		}
+		streamSettings["realitySettings"] = realitySettings
+	}
+
+	return map[string]interface{}{
+		"tag":            tag,
+		"protocol":       node.Protocol,
+		"settings":       settings,
+		"streamSettings": streamSettings,
+	}, nil
+}
@@ -0,0 +1,167 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	proxyman_command "github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/common/protocol"
+	"google.golang.org/protobuf/proto"
+
+	"xray-api-bridge/store"
+)
+
+// Reasons a user can be suspended for. A user stays suspended until every reason is lifted.
+const (
+	suspendReasonQuota       = "quota"
+	suspendReasonExpired     = "expired"
+	suspendReasonDeviceLimit = "device-limit"
+)
+
+// inboundAccount is a user account held by a single inbound.
+type inboundAccount struct {
+	tag  string
+	user *protocol.User
+}
+
+// findUserAccounts looks up every inbound holding an account with the given email.
+func (s *APIServer) findUserAccounts(ctx context.Context, email string) ([]inboundAccount, error) {
+	resp, err := s.xrayClient.HandlerClient.ListInbounds(ctx, &proxyman_command.ListInboundsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list inbounds: %w", err)
+	}
+
+	var accounts []inboundAccount
+	for _, inbound := range resp.GetInbounds() {
+		// Inbounds without users (dokodemo-door, api, ...) answer with an error, which is expected
+		usersResp, err := s.xrayClient.HandlerClient.GetInboundUsers(ctx, &proxyman_command.GetInboundUserRequest{Tag: inbound.Tag, Email: email})
+		if err != nil {
+			continue
+		}
+		for _, user := range usersResp.GetUsers() {
+			if user.Email == email {
+				accounts = append(accounts, inboundAccount{tag: inbound.Tag, user: user})
+			}
+		}
+	}
+	return accounts, nil
+}
+
+// suspendUser removes every account of a user from all inbounds and records why.
+// Suspending an already suspended user only adds the reason.
+func (s *APIServer) suspendUser(ctx context.Context, email, reason string) error {
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+
+	if suspension, ok := s.store.Suspensions.Get(email); ok {
+		if suspension.HasReason(reason) {
+			return nil
+		}
+		suspension.Reasons = append(suspension.Reasons, reason)
+		return s.store.Suspensions.Put(suspension)
+	}
+
+	accounts, err := s.findUserAccounts(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	suspension := store.Suspension{
+		Email:       email,
+		Reasons:     []string{reason},
+		SuspendedAt: time.Now(),
+	}
+	for _, account := range accounts {
+		data, err := proto.Marshal(account.user)
+		if err != nil {
+			return fmt.Errorf("could not encode account of %s in inbound %s: %w", email, account.tag, err)
+		}
+		suspension.Accounts = append(suspension.Accounts, store.SuspendedAccount{Tag: account.tag, User: data})
+	}
+
+	// Record the accounts before removing them, so they can never be lost
+	if err := s.store.Suspensions.Put(suspension); err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if err := s.removeInboundUser(ctx, account.tag, email); err != nil {
+			log.Printf("Warning: failed to remove suspended user %s from inbound %s: %v", email, account.tag, err)
+		}
+	}
+
+	log.Printf("Suspended user %s (%s), removed from %d inbounds", email, reason, len(accounts))
+	return nil
+}
+
+// resumeUser lifts one reason of a user's suspension. Once no reason is left,
+// every account removed at suspension time is added back to its inbound.
+func (s *APIServer) resumeUser(ctx context.Context, email, reason string) error {
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+
+	suspension, ok := s.store.Suspensions.Get(email)
+	if !ok || !suspension.HasReason(reason) {
+		return nil
+	}
+
+	remaining := make([]string, 0, len(suspension.Reasons))
+	for _, r := range suspension.Reasons {
+		if r != reason {
+			remaining = append(remaining, r)
+		}
+	}
+	if len(remaining) > 0 {
+		suspension.Reasons = remaining
+		return s.store.Suspensions.Put(suspension)
+	}
+
+	for _, account := range suspension.Accounts {
+		var user protocol.User
+		if err := proto.Unmarshal(account.User, &user); err != nil {
+			log.Printf("Warning: failed to decode suspended account of %s in inbound %s: %v", email, account.Tag, err)
+			continue
+		}
+		if err := s.addProtocolUser(ctx, account.Tag, &user); err != nil && !isAlreadyExistsError(err) {
+			log.Printf("Warning: failed to restore user %s to inbound %s: %v", email, account.Tag, err)
+		}
+	}
+
+	log.Printf("Resumed user %s (%s), restored to %d inbounds", email, reason, len(suspension.Accounts))
+	return s.store.Suspensions.Delete(email)
+}
+
+// reapplySuspensions removes suspended users that came back with a fresh Xray-core process,
+// e.g. users defined in Xray-core's own configuration file.
+func (s *APIServer) reapplySuspensions(ctx context.Context) {
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+
+	removed := 0
+	for _, suspension := range s.store.Suspensions.List() {
+		for _, account := range suspension.Accounts {
+			// Most accounts are already gone, so failures are expected here
+			if err := s.removeInboundUser(ctx, account.Tag, suspension.Email); err == nil {
+				removed++
+			}
+		}
+	}
+	if removed > 0 {
+		log.Printf("Removed %d accounts of suspended users from Xray-core", removed)
+	}
+}
+
+// newSuspendedUserResponse converts a stored suspension into its API representation.
+func newSuspendedUserResponse(suspension store.Suspension) SuspendedUserResponse {
+	inbounds := make([]string, 0, len(suspension.Accounts))
+	for _, account := range suspension.Accounts {
+		inbounds = append(inbounds, account.Tag)
+	}
+	return SuspendedUserResponse{
+		Email:       suspension.Email,
+		Reasons:     suspension.Reasons,
+		SuspendedAt: suspension.SuspendedAt,
+		Inbounds:    inbounds,
+	}
+}
@@ -0,0 +1,128 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	stats_command "github.com/xtls/xray-core/app/stats/command"
+)
+
+// userStatPrefix is the prefix of every per-user counter, named user>>>{email}>>>traffic>>>{uplink|downlink}.
+const userStatPrefix = "user>>>"
+
+// queryUserTraffic reads the per-user traffic counters from Xray-core, keyed by email.
+// An empty email reads the counters of every user.
+func (s *APIServer) queryUserTraffic(ctx context.Context, email string, reset bool) (map[string]UserTraffic, error) {
+	stats, err := s.queryUserStats(ctx, email, reset)
+	if err != nil {
+		return nil, err
+	}
+	return userTrafficOf(stats, email), nil
+}
+
+// queryUserStats reads the raw per-user traffic counters of a user, or of every user.
+func (s *APIServer) queryUserStats(ctx context.Context, email string, reset bool) ([]*stats_command.Stat, error) {
+	pattern := userStatPrefix
+	if email != "" {
+		pattern = userStatPrefix + email + ">>>traffic>>>"
+	}
+
+	resp, err := s.xrayClient.StatsClient.QueryStats(ctx, &stats_command.QueryStatsRequest{
+		Pattern: pattern,
+		Reset_:  reset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not query user stats: %w", err)
+	}
+	return resp.GetStat(), nil
+}
+
+// parseUserTrafficStat splits a user>>>{email}>>>traffic>>>{uplink|downlink} counter name.
+func parseUserTrafficStat(name string) (email, direction string, ok bool) {
+	parts := strings.Split(name, ">>>")
+	if len(parts) != 4 || parts[0] != "user" || parts[2] != "traffic" {
+		return "", "", false
+	}
+	if parts[3] != "uplink" && parts[3] != "downlink" {
+		return "", "", false
+	}
+	return parts[1], parts[3], true
+}
+
+// userTrafficOf sums per-user counters by email. A non-empty email keeps only that user's.
+func userTrafficOf(stats []*stats_command.Stat, email string) map[string]UserTraffic {
+	traffic := make(map[string]UserTraffic)
+	for _, stat := range stats {
+		statEmail, direction, ok := parseUserTrafficStat(stat.Name)
+		// The pattern is a substring match, so it can catch longer emails too
+		if !ok || (email != "" && statEmail != email) {
+			continue
+		}
+
+		t := traffic[statEmail]
+		t.Email = statEmail
+		if direction == "uplink" {
+			t.Uplink = stat.Value
+		} else {
+			t.Downlink = stat.Value
+		}
+		t.Total = t.Uplink + t.Downlink
+		traffic[statEmail] = t
+	}
+	return traffic
+}
+
+// userTrafficSortKeys are the fields GET /users/traffic can be sorted by.
+var userTrafficSortKeys = map[string]func(t UserTraffic) int64{
+	"uplink":   func(t UserTraffic) int64 { return t.Uplink },
+	"downlink": func(t UserTraffic) int64 { return t.Downlink },
+	"total":    func(t UserTraffic) int64 { return t.Total },
+}
+
+// sortUserTraffic orders users by email, or by one of the traffic fields.
+// Emails sort ascending and traffic fields descending unless an order is given.
+func sortUserTraffic(traffic []UserTraffic, key, order string) error {
+	if order != "" && order != "asc" && order != "desc" {
+		return fmt.Errorf("unsupported order '%s', expected 'asc' or 'desc'", order)
+	}
+
+	sort.Slice(traffic, func(i, j int) bool { return traffic[i].Email < traffic[j].Email })
+	if key == "" || key == "email" {
+		if order == "desc" {
+			sort.SliceStable(traffic, func(i, j int) bool { return traffic[i].Email > traffic[j].Email })
+		}
+		return nil
+	}
+
+	value, ok := userTrafficSortKeys[key]
+	if !ok {
+		return fmt.Errorf("unsupported sort key '%s', expected 'email', 'uplink', 'downlink' or 'total'", key)
+	}
+	sort.SliceStable(traffic, func(i, j int) bool {
+		if order == "asc" {
+			return value(traffic[i]) < value(traffic[j])
+		}
+		return value(traffic[i]) > value(traffic[j])
+	})
+	return nil
+}
+
+// readUserTraffic reads the per-user traffic counters for an API request. When the counters are
+// reset, the traffic read is first credited to the users' quotas so no usage is lost.
+func (s *APIServer) readUserTraffic(ctx context.Context, email string, reset bool) (map[string]UserTraffic, error) {
+	if !reset {
+		return s.queryUserTraffic(ctx, email, false)
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	stats, err := s.queryUserStats(ctx, email, true)
+	if err != nil {
+		return nil, err
+	}
+	s.creditResetStats(stats)
+	return userTrafficOf(stats, email), nil
+}
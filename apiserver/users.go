@@ -0,0 +1,345 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	proxyman_command "github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/serial"
+	"google.golang.org/grpc/status"
+
+	"xray-api-bridge/store"
+)
+
+// addInboundUser sends an AddUserOperation for a single user to the inbound identified by tag,
+// building the account type that matches the inbound's protocol.
+func (s *APIServer) addInboundUser(ctx context.Context, tag, protocolName string, user SimplifiedUser) error {
+	account, err := buildAccount(protocolName, user)
+	if err != nil {
+		return err
+	}
+
+	return s.addProtocolUser(ctx, tag, &protocol.User{
+		Level:   user.Level,
+		Email:   user.Email,
+		Account: serial.ToTypedMessage(account),
+	})
+}
+
+// validateUser checks a user submitted to an inbound before anything is sent to Xray-core.
+func validateUser(protocolName string, user SimplifiedUser) error {
+	if user.ExpireAt != nil && !user.ExpireAt.After(time.Now()) {
+		return fmt.Errorf("expireAt of user %s is not in the future", user.Email)
+	}
+	_, err := buildAccount(protocolName, user)
+	return err
+}
+
+// suspendedUserError returns an error naming the first of the users that is suspended, if any.
+// Adding a suspended user back would get around the suspension, which restores the user's
+// accounts itself once every reason is lifted.
+func (s *APIServer) suspendedUserError(users ...SimplifiedUser) error {
+	for _, u := range users {
+		if suspension, ok := s.store.Suspensions.Get(u.Email); ok {
+			return fmt.Errorf("User %s is suspended (%s) and is added back once the suspension is lifted", u.Email, strings.Join(suspension.Reasons, ", "))
+		}
+	}
+	return nil
+}
+
+// addProtocolUser sends an AddUserOperation for an already built protocol.User.
+func (s *APIServer) addProtocolUser(ctx context.Context, tag string, user *protocol.User) error {
+	operation := &proxyman_command.AddUserOperation{
+		User: user,
+	}
+
+	req := &proxyman_command.AlterInboundRequest{
+		Tag:       tag,
+		Operation: serial.ToTypedMessage(operation),
+	}
+
+	_, err := s.xrayClient.HandlerClient.AlterInbound(ctx, req)
+	return err
+}
+
+// removeInboundUser sends a RemoveUserOperation for a single email to the inbound identified by tag.
+func (s *APIServer) removeInboundUser(ctx context.Context, tag, email string) error {
+	operation := &proxyman_command.RemoveUserOperation{
+		Email: email,
+	}
+
+	req := &proxyman_command.AlterInboundRequest{
+		Tag:       tag,
+		Operation: serial.ToTypedMessage(operation),
+	}
+
+	_, err := s.xrayClient.HandlerClient.AlterInbound(ctx, req)
+	return err
+}
+
+// Batch modes accepted by the user endpoints through the `mode` query parameter.
+const (
+	// batchModeDefault stops at the first failure and leaves earlier operations applied.
+	batchModeDefault = ""
+	// batchModeAtomic undoes every completed operation when one fails.
+	batchModeAtomic = "atomic"
+	// batchModeBestEffort attempts every operation and reports a result for each user.
+	batchModeBestEffort = "best-effort"
+)
+
+// parseBatchMode reads the batch mode of a user endpoint request.
+func parseBatchMode(r *http.Request) (string, error) {
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case batchModeDefault, batchModeAtomic, batchModeBestEffort:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported mode '%s', expected '%s' or '%s'", mode, batchModeAtomic, batchModeBestEffort)
+	}
+}
+
+// newUserOperationResult builds the per-user result of a best-effort batch.
+func newUserOperationResult(email string, err error) UserOperationResult {
+	if err == nil {
+		return UserOperationResult{Email: email, Status: "ok"}
+	}
+	return UserOperationResult{
+		Email:  email,
+		Status: "failed",
+		Code:   status.Code(err).String(),
+		Error:  err.Error(),
+	}
+}
+
+// rollbackAddedUsers removes users added earlier in an atomic batch.
+func (s *APIServer) rollbackAddedUsers(ctx context.Context, tag string, users []SimplifiedUser) error {
+	var failed []string
+	for _, user := range users {
+		if err := s.removeInboundUser(ctx, tag, user.Email); err != nil {
+			failed = append(failed, user.Email)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not roll back users %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// rollbackRemovedUsers adds back users removed earlier in an atomic batch.
+func (s *APIServer) rollbackRemovedUsers(ctx context.Context, tag string, users []*protocol.User) error {
+	var failed []string
+	for _, user := range users {
+		if err := s.addProtocolUser(ctx, tag, user); err != nil {
+			failed = append(failed, user.Email)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not roll back users %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// diffInboundUsers compares the users an inbound currently holds with the desired ones, keyed by email.
+// Users whose account or level changed are reported as updated and must be removed and added again.
+func diffInboundUsers(current []*protocol.User, desired []SimplifiedUser) (toAdd []SimplifiedUser, toRemove []string, toUpdate []SimplifiedUser, unchanged int) {
+	currentByEmail := make(map[string]*protocol.User, len(current))
+	for _, u := range current {
+		currentByEmail[u.Email] = u
+	}
+
+	desiredEmails := make(map[string]struct{}, len(desired))
+	for _, d := range desired {
+		desiredEmails[d.Email] = struct{}{}
+
+		existing, ok := currentByEmail[d.Email]
+		switch {
+		case !ok:
+			toAdd = append(toAdd, d)
+		case !sameInboundUser(existing, d):
+			toUpdate = append(toUpdate, d)
+		default:
+			unchanged++
+		}
+	}
+
+	for _, u := range current {
+		if _, ok := desiredEmails[u.Email]; !ok {
+			toRemove = append(toRemove, u.Email)
+		}
+	}
+
+	return toAdd, toRemove, toUpdate, unchanged
+}
+
+// applyInboundUsersDiff applies the result of diffInboundUsers to an inbound, recording each
+// completed operation in diff. Removals go first, so updated users can be added again with their
+// new account. It stops at the first failure, with the store updated for the operations applied
+// so far; an update that fails after its user was removed puts the previous account back.
+func (s *APIServer) applyInboundUsersDiff(ctx context.Context, tag, protocolName string, current []*protocol.User, toAdd []SimplifiedUser, toRemove []string, toUpdate []SimplifiedUser, diff *InboundUsersDiff) (err error) {
+	var applied []SimplifiedUser
+	var removed []string
+	defer func() {
+		// Once everything is applied, the caller stores the desired users as a whole
+		if err != nil {
+			s.unstoreUsers(tag, removed...)
+			s.storeUsers(tag, protocolName, applied...)
+			s.storeExpiries(ctx, applied...)
+			s.assignUserShortIDs(ctx, tag, applied...)
+		}
+	}()
+
+	for _, email := range toRemove {
+		if err := s.removeInboundUser(ctx, tag, email); err != nil {
+			return fmt.Errorf("Failed to remove user %s from inbound %s: %v", email, tag, err)
+		}
+		removed = append(removed, email)
+		diff.Removed = append(diff.Removed, email)
+	}
+
+	currentByEmail := make(map[string]*protocol.User, len(current))
+	for _, u := range current {
+		currentByEmail[u.Email] = u
+	}
+	for _, user := range toUpdate {
+		if err := s.removeInboundUser(ctx, tag, user.Email); err != nil {
+			return fmt.Errorf("Failed to remove user %s from inbound %s: %v", user.Email, tag, err)
+		}
+		if err := s.addInboundUser(ctx, tag, protocolName, user); err != nil {
+			// Put the previous account back, even if the client already went away
+			if restoreErr := s.addProtocolUser(context.WithoutCancel(ctx), tag, currentByEmail[user.Email]); restoreErr != nil {
+				removed = append(removed, user.Email)
+				diff.Removed = append(diff.Removed, user.Email)
+				return fmt.Errorf("Failed to update user %s in inbound %s: %v; restoring the previous account failed: %v", user.Email, tag, err, restoreErr)
+			}
+			return fmt.Errorf("Failed to update user %s in inbound %s: %v; the previous account was restored", user.Email, tag, err)
+		}
+		applied = append(applied, user)
+		diff.Updated = append(diff.Updated, user.Email)
+	}
+
+	for _, user := range toAdd {
+		if err := s.addInboundUser(ctx, tag, protocolName, user); err != nil {
+			return fmt.Errorf("Failed to add user %s to inbound %s: %v", user.Email, tag, err)
+		}
+		applied = append(applied, user)
+		diff.Added = append(diff.Added, user.Email)
+	}
+	return nil
+}
+
+// sameInboundUser reports whether a user held by Xray-core matches the desired user.
+func sameInboundUser(existing *protocol.User, desired SimplifiedUser) bool {
+	return existing.Level == desired.Level && sameAccount(existing, desired)
+}
+
+// toStoredUser converts a user pushed to an inbound into the form kept in the bridge's user store.
+func toStoredUser(tag, protocolName string, u SimplifiedUser) store.User {
+	return store.User{
+		Tag:      tag,
+		Email:    u.Email,
+		ID:       u.ID,
+		Flow:     u.Flow,
+		Level:    u.Level,
+		Protocol: protocolName,
+		Security: u.Security,
+		Password: u.Password,
+		Method:   u.Method,
+	}
+}
+
+// fromStoredUser converts a stored user back into the form accepted by addInboundUser.
+func fromStoredUser(u store.User) SimplifiedUser {
+	return SimplifiedUser{
+		ID:       u.ID,
+		Email:    u.Email,
+		Flow:     u.Flow,
+		Level:    u.Level,
+		Security: u.Security,
+		Password: u.Password,
+		Method:   u.Method,
+	}
+}
+
+// storeUsers records users pushed to an inbound in the bridge's user store.
+func (s *APIServer) storeUsers(tag, protocolName string, users ...SimplifiedUser) {
+	stored := make([]store.User, 0, len(users))
+	for _, u := range users {
+		stored = append(stored, toStoredUser(tag, protocolName, u))
+	}
+	if err := s.store.Users.Put(stored...); err != nil {
+		log.Printf("Warning: failed to persist users of inbound %s: %v", tag, err)
+	}
+}
+
+// replaceStoredUsers makes the bridge's user store hold exactly the given users for an inbound.
+func (s *APIServer) replaceStoredUsers(tag, protocolName string, users ...SimplifiedUser) {
+	stored := make([]store.User, 0, len(users))
+	for _, u := range users {
+		stored = append(stored, toStoredUser(tag, protocolName, u))
+	}
+	if err := s.store.Users.ReplaceTag(tag, stored...); err != nil {
+		log.Printf("Warning: failed to persist users of inbound %s: %v", tag, err)
+	}
+}
+
+// unstoreUsers drops users removed from an inbound from the bridge's user store.
+func (s *APIServer) unstoreUsers(tag string, emails ...string) {
+	if err := s.store.Users.Delete(tag, emails...); err != nil {
+		log.Printf("Warning: failed to persist user removal from inbound %s: %v", tag, err)
+	}
+	s.dropShortIDs(tag, emails...)
+}
+
+// inboundUserEmails returns the emails of every user held by any inbound of Xray-core.
+func (s *APIServer) inboundUserEmails(ctx context.Context) (map[string]struct{}, error) {
+	resp, err := s.xrayClient.HandlerClient.ListInbounds(ctx, &proxyman_command.ListInboundsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list inbounds: %w", err)
+	}
+
+	emails := make(map[string]struct{})
+	for _, inbound := range resp.GetInbounds() {
+		// Inbounds without users answer with an error, which is expected
+		usersResp, err := s.xrayClient.HandlerClient.GetInboundUsers(ctx, &proxyman_command.GetInboundUserRequest{Tag: inbound.Tag})
+		if err != nil {
+			continue
+		}
+		for _, user := range usersResp.GetUsers() {
+			emails[user.Email] = struct{}{}
+		}
+	}
+	return emails, nil
+}
+
+// forgetRemovedUsers revokes the subscription token and drops the REALITY shortId assignments of
+// users that were removed from the last inbound holding them, so that a later user with the same
+// email does not inherit them. Suspended users keep both, as they are only out of their inbounds
+// until they resume.
+func (s *APIServer) forgetRemovedUsers(ctx context.Context, emails ...string) {
+	if len(emails) == 0 {
+		return
+	}
+	// Finish the cleanup even if the client already went away
+	remaining, err := s.inboundUserEmails(context.WithoutCancel(ctx))
+	if err != nil {
+		log.Printf("Warning: could not check whether removed users are left in any inbound: %v", err)
+		return
+	}
+
+	for _, email := range emails {
+		if _, ok := remaining[email]; ok || s.store.Suspensions.IsSuspended(email) {
+			continue
+		}
+		if err := s.store.SubscriptionTokens.Delete(email); err != nil {
+			log.Printf("Warning: failed to revoke subscription token of removed user %s: %v", email, err)
+		}
+		if err := s.store.ShortIDs.DeleteEmail(email); err != nil {
+			log.Printf("Warning: failed to drop shortIds of removed user %s: %v", email, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package apiserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/serial"
+)
+
+// inboundUser builds a user as an inbound holds it, with the account serialised the way
+// GetInboundUsers returns it.
+func inboundUser(t *testing.T, protocolName string, user SimplifiedUser) *protocol.User {
+	t.Helper()
+	account, err := buildAccount(protocolName, user)
+	if err != nil {
+		t.Fatalf("buildAccount(%s, %s): %v", protocolName, user.Email, err)
+	}
+	return &protocol.User{Email: user.Email, Level: user.Level, Account: serial.ToTypedMessage(account)}
+}
+
+func TestDiffInboundUsers(t *testing.T) {
+	const (
+		id1 = "b831381d-6324-4d53-ad4f-8cda48b30811"
+		id2 = "27848739-7e62-4138-9fd3-098a63964b6b"
+	)
+	tests := []struct {
+		name          string
+		protocol      string
+		current       []SimplifiedUser
+		desired       []SimplifiedUser
+		wantAdd       []string
+		wantRemove    []string
+		wantUpdate    []string
+		wantUnchanged int
+	}{
+		{
+			name:     "empty inbound",
+			protocol: "vless",
+			desired:  []SimplifiedUser{{Email: "a", ID: id1}, {Email: "b", ID: id2}},
+			wantAdd:  []string{"a", "b"},
+		},
+		{
+			name:       "empty desired",
+			protocol:   "vless",
+			current:    []SimplifiedUser{{Email: "a", ID: id1}},
+			wantRemove: []string{"a"},
+		},
+		{
+			name:          "unchanged",
+			protocol:      "vless",
+			current:       []SimplifiedUser{{Email: "a", ID: id1, Flow: "xtls-rprx-vision", Level: 1}},
+			desired:       []SimplifiedUser{{Email: "a", ID: id1, Flow: "xtls-rprx-vision", Level: 1}},
+			wantUnchanged: 1,
+		},
+		{
+			name:       "changed id",
+			protocol:   "vless",
+			current:    []SimplifiedUser{{Email: "a", ID: id1}},
+			desired:    []SimplifiedUser{{Email: "a", ID: id2}},
+			wantUpdate: []string{"a"},
+		},
+		{
+			name:       "changed flow",
+			protocol:   "vless",
+			current:    []SimplifiedUser{{Email: "a", ID: id1}},
+			desired:    []SimplifiedUser{{Email: "a", ID: id1, Flow: "xtls-rprx-vision"}},
+			wantUpdate: []string{"a"},
+		},
+		{
+			name:       "changed level",
+			protocol:   "trojan",
+			current:    []SimplifiedUser{{Email: "a", Password: "secret"}},
+			desired:    []SimplifiedUser{{Email: "a", Password: "secret", Level: 2}},
+			wantUpdate: []string{"a"},
+		},
+		{
+			// Xray-core normalises the vmess security, so only the id tells accounts apart
+			name:          "vmess security ignored",
+			protocol:      "vmess",
+			current:       []SimplifiedUser{{Email: "a", ID: id1, Security: "aes-128-gcm"}},
+			desired:       []SimplifiedUser{{Email: "a", ID: id1, Security: "auto"}},
+			wantUnchanged: 1,
+		},
+		{
+			name:       "changed shadowsocks method",
+			protocol:   "shadowsocks",
+			current:    []SimplifiedUser{{Email: "a", Password: "secret", Method: "aes-128-gcm"}},
+			desired:    []SimplifiedUser{{Email: "a", Password: "secret", Method: "chacha20-poly1305"}},
+			wantUpdate: []string{"a"},
+		},
+		{
+			name:          "mixed",
+			protocol:      "trojan",
+			current:       []SimplifiedUser{{Email: "keep", Password: "1"}, {Email: "drop", Password: "2"}, {Email: "change", Password: "3"}},
+			desired:       []SimplifiedUser{{Email: "change", Password: "4"}, {Email: "new", Password: "5"}, {Email: "keep", Password: "1"}},
+			wantAdd:       []string{"new"},
+			wantRemove:    []string{"drop"},
+			wantUpdate:    []string{"change"},
+			wantUnchanged: 1,
+		},
+	}
+
+	emails := func(users []SimplifiedUser) []string {
+		var emails []string
+		for _, u := range users {
+			emails = append(emails, u.Email)
+		}
+		return emails
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var current []*protocol.User
+			for _, u := range tt.current {
+				current = append(current, inboundUser(t, tt.protocol, u))
+			}
+
+			toAdd, toRemove, toUpdate, unchanged := diffInboundUsers(current, tt.desired)
+			if got := emails(toAdd); !reflect.DeepEqual(got, tt.wantAdd) {
+				t.Errorf("toAdd = %v, want %v", got, tt.wantAdd)
+			}
+			if !reflect.DeepEqual(toRemove, tt.wantRemove) {
+				t.Errorf("toRemove = %v, want %v", toRemove, tt.wantRemove)
+			}
+			if got := emails(toUpdate); !reflect.DeepEqual(got, tt.wantUpdate) {
+				t.Errorf("toUpdate = %v, want %v", got, tt.wantUpdate)
+			}
+			if unchanged != tt.wantUnchanged {
+				t.Errorf("unchanged = %d, want %d", unchanged, tt.wantUnchanged)
+			}
+
+			// Users to add and update are passed on as desired, to be built into accounts again
+			for _, u := range append(toAdd, toUpdate...) {
+				for _, d := range tt.desired {
+					if d.Email == u.Email && !reflect.DeepEqual(d, u) {
+						t.Errorf("user %s = %+v, want %+v", u.Email, u, d)
+					}
+				}
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/xtls/xray-core v1.251015.0
 	google.golang.org/grpc v1.76.0
 	google.golang.org/protobuf v1.36.10
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
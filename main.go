@@ -9,12 +9,14 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"xray-api-bridge/apiserver"
 	"xray-api-bridge/bridge"
+	"xray-api-bridge/store"
 	"xray-api-bridge/xrayapi"
 )
 
@@ -54,6 +56,63 @@ func main() {
 	// subsConfigPath can be empty if subscription endpoint is not used.
 	// The handler for that endpoint should check if the path is configured.
 
+	adminKey := os.Getenv("XRAY_API_BRIDGE_SUBS_SUPERKEY")
+	if adminKey == "" {
+		log.Printf("XRAY_API_BRIDGE_SUBS_SUPERKEY not set, subscription admin endpoints are disabled")
+	}
+
+	subsOptions := apiserver.SubscriptionOptions{
+		UpdateInterval: 12, // Default update interval suggested to subscription clients, in hours
+		Name:           os.Getenv("XRAY_API_BRIDGE_SUBS_NAME"),
+		// An empty template path selects the built-in template
+		ClashTemplate:   os.Getenv("XRAY_API_BRIDGE_SUBS_CLASH_TEMPLATE"),
+		SingboxTemplate: os.Getenv("XRAY_API_BRIDGE_SUBS_SINGBOX_TEMPLATE"),
+		XrayTemplate:    os.Getenv("XRAY_API_BRIDGE_SUBS_XRAY_TEMPLATE"),
+	}
+	if v := os.Getenv("XRAY_API_BRIDGE_SUBS_UPDATE_INTERVAL"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil && hours > 0 {
+			subsOptions.UpdateInterval = hours
+		} else {
+			log.Printf("Invalid XRAY_API_BRIDGE_SUBS_UPDATE_INTERVAL %q, using default: %d", v, subsOptions.UpdateInterval)
+		}
+	}
+	if subsOptions.Name == "" {
+		subsOptions.Name = "xray-api-bridge" // Default subscription name shown by clients
+	}
+
+	dataDir := os.Getenv("XRAY_API_BRIDGE_DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data" // Default data directory, relative to the working directory
+		log.Printf("XRAY_API_BRIDGE_DATA_DIR not set, using default: %s", dataDir)
+	}
+
+	// Open the on-disk store holding everything the bridge manages
+	bridgeStore, err := store.Open(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to open bridge data store: %v", err)
+	}
+
+	watchInterval := envDuration("XRAY_API_BRIDGE_WATCH_INTERVAL", 10*time.Second) // Default interval for detecting Xray-core restarts
+
+	quotaInterval := envDuration("XRAY_API_BRIDGE_QUOTA_INTERVAL", time.Minute) // Default interval for accounting user traffic against quotas
+
+	expiryInterval := envDuration("XRAY_API_BRIDGE_EXPIRY_INTERVAL", time.Minute) // Default interval for suspending expired users
+
+	historyInterval := envDuration("XRAY_API_BRIDGE_HISTORY_INTERVAL", time.Minute) // Default interval for sampling traffic history
+
+	deviceLimitInterval := envDuration("XRAY_API_BRIDGE_DEVICE_LIMIT_INTERVAL", 30*time.Second) // Default interval for checking user device limits
+
+	deviceLimitOptions := apiserver.DeviceLimitOptions{
+		// The webhook is optional; limits with the webhook action only log without it
+		WebhookURL:       os.Getenv("XRAY_API_BRIDGE_DEVICE_LIMIT_WEBHOOK"),
+		BlockOutboundTag: os.Getenv("XRAY_API_BRIDGE_DEVICE_LIMIT_BLOCK_OUTBOUND"),
+	}
+	if deviceLimitOptions.BlockOutboundTag == "" {
+		deviceLimitOptions.BlockOutboundTag = "block" // Default outbound for blocked source IPs
+	}
+
+	subsReloadInterval := envDuration("XRAY_API_BRIDGE_SUBS_RELOAD_INTERVAL", 5*time.Second) // Default interval for checking the subscription config file for changes
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -68,7 +127,35 @@ func main() {
 	fmt.Println("Successfully connected to Xray gRPC server.")
 
 	// Initialize Chi router and API server
-	apiServer := apiserver.NewAPIServer(xrayClient, listenAddr, subsConfigPath)
+	apiServer := apiserver.NewAPIServer(xrayClient, listenAddr, subsConfigPath, adminKey, subsOptions, bridgeStore)
+
+	// Put everything managed by the bridge back into Xray-core
+	restoreCtx, restoreCancel := context.WithTimeout(ctx, 30*time.Second)
+	apiServer.Reconcile(restoreCtx)
+	restoreCancel()
+
+	// Watch for Xray-core restarts and reconcile whenever a fresh process shows up
+	go xrayClient.Watch(ctx, watchInterval, func(event xrayapi.RestartEvent) {
+		log.Printf("Xray-core restarted at %s, reconciling bridge-managed configuration...", event.DetectedAt.Format(time.RFC3339))
+		reconcileCtx, reconcileCancel := context.WithTimeout(ctx, 30*time.Second)
+		defer reconcileCancel()
+		apiServer.Reconcile(reconcileCtx)
+	})
+
+	// Account user traffic and suspend users over their quota
+	go apiServer.RunQuotaEnforcer(ctx, quotaInterval)
+
+	// Suspend users once their expiry date has passed
+	go apiServer.RunExpiryScheduler(ctx, expiryInterval)
+
+	// Record traffic history of users, inbounds and outbounds
+	go apiServer.RunHistorySampler(ctx, historyInterval)
+
+	// Act on users online from more source IPs than their device limit allows
+	go apiServer.RunDeviceLimitEnforcer(ctx, deviceLimitInterval, deviceLimitOptions)
+
+	// Reload the subscription profiles whenever their file is edited
+	go apiServer.RunSubscriptionProfileWatcher(ctx, subsReloadInterval)
 
 	// Start the HTTP server in a goroutine
 	go func() {
@@ -137,3 +224,16 @@ func main() {
 	fmt.Println("Xray API Bridge stopped.")
 }
 
+// envDuration reads a positive duration from the named environment variable, falling back to
+// def when it is unset or invalid.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d
+	}
+	log.Printf("Invalid %s %q, using default: %s", name, v, def)
+	return def
+}
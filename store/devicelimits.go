@@ -0,0 +1,36 @@
+package store
+
+import "time"
+
+// DeviceBlock is a source IP of a user blocked by a routing rule for going over the device limit.
+type DeviceBlock struct {
+	IP      string    `json:"ip"`
+	RuleTag string    `json:"ruleTag"`
+	Until   time.Time `json:"until"`
+}
+
+// DeviceLimit caps the number of source IPs a user may be online from at the same time.
+type DeviceLimit struct {
+	Email  string `json:"email"`
+	MaxIPs int    `json:"maxIPs"`
+	// Action is what happens when the limit is exceeded: "log", "webhook", "kick" or "block".
+	Action string `json:"action"`
+	// Duration is how long a kick or a block lasts.
+	Duration time.Duration `json:"duration"`
+	// KickedUntil is set while the user is kicked out of every inbound.
+	KickedUntil *time.Time    `json:"kickedUntil,omitempty"`
+	Blocks      []DeviceBlock `json:"blocks,omitempty"`
+}
+
+// DeviceLimitStore keeps the user device limits and the actions in force, keyed by email.
+type DeviceLimitStore struct {
+	*keyedStore[DeviceLimit]
+}
+
+func openDeviceLimitStore(path string) (*DeviceLimitStore, error) {
+	s, err := openKeyedStore(path, func(v DeviceLimit) string { return v.Email })
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceLimitStore{s}, nil
+}
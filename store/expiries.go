@@ -0,0 +1,24 @@
+package store
+
+import "time"
+
+// Expiry is the date after which a user is taken out of every inbound.
+type Expiry struct {
+	Email    string    `json:"email"`
+	ExpireAt time.Time `json:"expireAt"`
+	// ExpiredAt is when the bridge suspended the user for being expired, if it has.
+	ExpiredAt *time.Time `json:"expiredAt,omitempty"`
+}
+
+// ExpiryStore keeps the user expiry dates, keyed by email.
+type ExpiryStore struct {
+	*keyedStore[Expiry]
+}
+
+func openExpiryStore(path string) (*ExpiryStore, error) {
+	s, err := openKeyedStore(path, func(v Expiry) string { return v.Email })
+	if err != nil {
+		return nil, err
+	}
+	return &ExpiryStore{s}, nil
+}
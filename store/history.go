@@ -0,0 +1,256 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryPoint is the traffic counted over one step of a history query.
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Value int64     `json:"value"`
+}
+
+// historyLevel is one resolution of the history store. Its buckets are grouped into partitions,
+// one file each, so that adding a sample only rewrites the partition currently being filled.
+type historyLevel struct {
+	dir    string
+	step   time.Duration
+	layout string // time layout of partition keys, also used as file names
+	// partition returns the start and end of the partition holding t.
+	partition func(t time.Time) (start, end time.Time)
+	// keep is how many partitions before the current one are retained.
+	keep    int
+	current *historyPartition
+}
+
+// historyPartition holds one bucket slice per counter name.
+type historyPartition struct {
+	start  time.Time
+	end    time.Time
+	series map[string][]int64
+}
+
+// HistoryStore is an embedded time-series store of counter deltas, rolled up into hourly buckets
+// (one partition per day) and daily buckets (one partition per month). All times are UTC.
+type HistoryStore struct {
+	mu     sync.Mutex
+	dir    string
+	levels []*historyLevel
+
+	counters     map[string]int64
+	countersTime time.Time
+}
+
+// historyCounters is the on-disk form of the counter values the last sample was taken from.
+type historyCounters struct {
+	Time     time.Time        `json:"time"`
+	Counters map[string]int64 `json:"counters"`
+}
+
+func openHistoryStore(dir string) (*HistoryStore, error) {
+	s := &HistoryStore{
+		dir: dir,
+		levels: []*historyLevel{
+			{
+				dir:    filepath.Join(dir, "hourly"),
+				step:   time.Hour,
+				layout: "2006-01-02",
+				partition: func(t time.Time) (time.Time, time.Time) {
+					start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+					return start, start.AddDate(0, 0, 1)
+				},
+				keep: 92, // days
+			},
+			{
+				dir:    filepath.Join(dir, "daily"),
+				step:   24 * time.Hour,
+				layout: "2006-01",
+				partition: func(t time.Time) (time.Time, time.Time) {
+					start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+					return start, start.AddDate(0, 1, 0)
+				},
+				keep: 25, // months
+			},
+		},
+	}
+
+	for _, level := range s.levels {
+		if err := os.MkdirAll(level.dir, 0o755); err != nil {
+			return nil, fmt.Errorf("could not create history directory %s: %w", level.dir, err)
+		}
+	}
+
+	var counters historyCounters
+	if err := readJSON(filepath.Join(dir, "counters.json"), &counters); err != nil {
+		return nil, err
+	}
+	s.counters = counters.Counters
+	s.countersTime = counters.Time
+	if s.counters == nil {
+		s.counters = make(map[string]int64)
+	}
+	return s, nil
+}
+
+// Counters returns the counter values the last sample was taken from, and when it was taken.
+func (s *HistoryStore) Counters() (map[string]int64, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters := make(map[string]int64, len(s.counters))
+	for name, value := range s.counters {
+		counters[name] = value
+	}
+	return counters, s.countersTime
+}
+
+// Add records the deltas counted at time t into every resolution, remembers the counter values
+// they were computed from, and persists the affected partitions.
+func (s *HistoryStore) Add(t time.Time, deltas, counters map[string]int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t = t.UTC()
+	for _, level := range s.levels {
+		p, err := level.open(t)
+		if err != nil {
+			return err
+		}
+		index := p.index(t, level.step)
+		for name, delta := range deltas {
+			if delta == 0 && p.series[name] == nil {
+				continue
+			}
+			buckets := p.series[name]
+			if buckets == nil {
+				buckets = make([]int64, p.buckets(level.step))
+				p.series[name] = buckets
+			}
+			buckets[index] += delta
+		}
+		if err := writeJSON(level.path(p.start), p.series); err != nil {
+			return err
+		}
+	}
+
+	s.counters = counters
+	s.countersTime = t
+	return writeJSON(filepath.Join(s.dir, "counters.json"), historyCounters{Time: t, Counters: counters})
+}
+
+// Query sums the deltas of a counter over consecutive steps from from (rounded down to the step)
+// until to. Steps of whole days are served from the daily buckets, other whole hours from the
+// hourly buckets.
+func (s *HistoryStore) Query(name string, from, to time.Time, step time.Duration) ([]HistoryPoint, error) {
+	var level *historyLevel
+	switch {
+	case step > 0 && step%(24*time.Hour) == 0:
+		level = s.levels[1]
+	case step > 0 && step%time.Hour == 0:
+		level = s.levels[0]
+	default:
+		return nil, fmt.Errorf("step must be a whole number of hours")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, to = from.UTC().Truncate(step), to.UTC()
+	partitions := make(map[time.Time]*historyPartition)
+	var points []HistoryPoint
+	for windowStart := from; windowStart.Before(to); windowStart = windowStart.Add(step) {
+		point := HistoryPoint{Time: windowStart}
+		for t := windowStart; t.Before(windowStart.Add(step)); t = t.Add(level.step) {
+			start, _ := level.partition(t)
+			p, ok := partitions[start]
+			if !ok {
+				var err error
+				if p, err = level.load(t); err != nil {
+					return nil, err
+				}
+				partitions[start] = p
+			}
+			if buckets := p.series[name]; buckets != nil {
+				point.Value += buckets[p.index(t, level.step)]
+			}
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// open returns the partition holding t, loading it and pruning expired partitions
+// when a new partition is started.
+func (l *historyLevel) open(t time.Time) (*historyPartition, error) {
+	if l.current != nil && !t.Before(l.current.start) && t.Before(l.current.end) {
+		return l.current, nil
+	}
+
+	p, err := l.load(t)
+	if err != nil {
+		return nil, err
+	}
+	l.current = p
+	l.prune(p.start)
+	return p, nil
+}
+
+// load reads the partition holding t from disk; a missing partition is empty.
+func (l *historyLevel) load(t time.Time) (*historyPartition, error) {
+	if l.current != nil && !t.Before(l.current.start) && t.Before(l.current.end) {
+		return l.current, nil
+	}
+
+	start, end := l.partition(t)
+	p := &historyPartition{start: start, end: end, series: make(map[string][]int64)}
+	if err := readJSON(l.path(start), &p.series); err != nil {
+		return nil, err
+	}
+	for name, buckets := range p.series {
+		if n := p.buckets(l.step); len(buckets) != n {
+			resized := make([]int64, n)
+			copy(resized, buckets)
+			p.series[name] = resized
+		}
+	}
+	return p, nil
+}
+
+// prune removes the partitions older than the retention of the level.
+func (l *historyLevel) prune(current time.Time) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return
+	}
+
+	// Walk back keep partitions from the current one
+	cutoff := current
+	for i := 0; i < l.keep; i++ {
+		cutoff, _ = l.partition(cutoff.Add(-time.Nanosecond))
+	}
+	for _, entry := range entries {
+		key := strings.TrimSuffix(entry.Name(), ".json")
+		start, err := time.Parse(l.layout, key)
+		if err != nil || !start.Before(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(l.dir, entry.Name()))
+	}
+}
+
+func (l *historyLevel) path(start time.Time) string {
+	return filepath.Join(l.dir, start.Format(l.layout)+".json")
+}
+
+func (p *historyPartition) buckets(step time.Duration) int {
+	return int(p.end.Sub(p.start) / step)
+}
+
+func (p *historyPartition) index(t time.Time, step time.Duration) int {
+	return int(t.Sub(p.start) / step)
+}
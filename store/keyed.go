@@ -0,0 +1,107 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// keyedStore keeps records in memory, keyed by a string derived from each record, and persists
+// them to a JSON file as a list ordered by key. It backs the per-user stores.
+type keyedStore[T any] struct {
+	mu    sync.RWMutex
+	path  string
+	key   func(T) string
+	items map[string]T
+}
+
+func openKeyedStore[T any](path string, key func(T) string) (*keyedStore[T], error) {
+	var items []T
+	if err := readJSON(path, &items); err != nil {
+		return nil, err
+	}
+
+	s := &keyedStore[T]{
+		path:  path,
+		key:   key,
+		items: make(map[string]T, len(items)),
+	}
+	for _, item := range items {
+		s.items[key(item)] = item
+	}
+	return s, nil
+}
+
+// Get returns the record with the given key, if any.
+func (s *keyedStore[T]) Get(key string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[key]
+	return item, ok
+}
+
+// Put adds or replaces the given records and persists the store.
+func (s *keyedStore[T]) Put(items ...T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, item := range items {
+		s.items[s.key(item)] = item
+	}
+	return s.save()
+}
+
+// Delete removes the records with the given keys and persists the store. Nothing is written
+// when none of them exist.
+func (s *keyedStore[T]) Delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := false
+	for _, key := range keys {
+		if _, ok := s.items[key]; ok {
+			delete(s.items, key)
+			deleted = true
+		}
+	}
+	if !deleted {
+		return nil
+	}
+	return s.save()
+}
+
+// List returns all records ordered by key.
+func (s *keyedStore[T]) List() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.filter(nil)
+}
+
+// Filter returns the records matching keep, ordered by key.
+func (s *keyedStore[T]) Filter(keep func(T) bool) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.filter(keep)
+}
+
+func (s *keyedStore[T]) filter(keep func(T) bool) []T {
+	keys := make([]string, 0, len(s.items))
+	for key, item := range s.items {
+		if keep == nil || keep(item) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	items := make([]T, len(keys))
+	for i, key := range keys {
+		items[i] = s.items[key]
+	}
+	return items
+}
+
+func (s *keyedStore[T]) save() error {
+	return writeJSON(s.path, s.filter(nil))
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Object is a configuration object (inbound, outbound or routing rule) added through the bridge,
+// kept in the JSON form it was submitted in.
+type Object struct {
+	Tag    string          `json:"tag"`
+	Config json.RawMessage `json:"config"`
+}
+
+// ObjectStore keeps bridge-managed configuration objects keyed by tag, in the order they were added.
+type ObjectStore struct {
+	mu      sync.RWMutex
+	path    string
+	objects []Object
+}
+
+func openObjectStore(path string) (*ObjectStore, error) {
+	s := &ObjectStore{path: path}
+	if err := readJSON(path, &s.objects); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put adds an object, or replaces the object with the same tag in place, and persists the store.
+func (s *ObjectStore) Put(tag string, config json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.objects {
+		if s.objects[i].Tag == tag {
+			s.objects[i].Config = config
+			return s.save()
+		}
+	}
+	s.objects = append(s.objects, Object{Tag: tag, Config: config})
+	return s.save()
+}
+
+// Delete removes the object with the given tag and persists the store.
+func (s *ObjectStore) Delete(tag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.objects {
+		if s.objects[i].Tag == tag {
+			s.objects = append(s.objects[:i], s.objects[i+1:]...)
+			return s.save()
+		}
+	}
+	return nil
+}
+
+// List returns all stored objects in the order they were added.
+func (s *ObjectStore) List() []Object {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	objects := make([]Object, len(s.objects))
+	copy(objects, s.objects)
+	return objects
+}
+
+func (s *ObjectStore) save() error {
+	objects := s.objects
+	if objects == nil {
+		objects = []Object{}
+	}
+	return writeJSON(s.path, objects)
+}
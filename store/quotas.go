@@ -0,0 +1,34 @@
+package store
+
+import "time"
+
+// Quota is the traffic allowance of a user, counted over uplink and downlink across all inbounds.
+type Quota struct {
+	Email string `json:"email"`
+	// Limit is the number of bytes the user may transfer in the current period.
+	Limit int64 `json:"limit"`
+	// Used is the number of bytes transferred so far in the current period.
+	Used int64 `json:"used"`
+	// UsedUplink and UsedDownlink split Used by direction.
+	UsedUplink   int64 `json:"usedUplink"`
+	UsedDownlink int64 `json:"usedDownlink"`
+	// Period is "monthly" for an allowance that renews every month, or empty for a one-off allowance.
+	Period      string    `json:"period,omitempty"`
+	PeriodStart time.Time `json:"periodStart"`
+	// LastUplink and LastDownlink are the Xray-core counter values last accounted for.
+	LastUplink   int64 `json:"lastUplink"`
+	LastDownlink int64 `json:"lastDownlink"`
+}
+
+// QuotaStore keeps the user traffic quotas, keyed by email.
+type QuotaStore struct {
+	*keyedStore[Quota]
+}
+
+func openQuotaStore(path string) (*QuotaStore, error) {
+	s, err := openKeyedStore(path, func(v Quota) string { return v.Email })
+	if err != nil {
+		return nil, err
+	}
+	return &QuotaStore{s}, nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import "time"
+
+// ShortID is the REALITY shortId assigned to a user on a REALITY inbound, so that the user keeps
+// the same shortId (and spiderX) in every subscription.
+type ShortID struct {
+	Tag        string    `json:"tag"`
+	Email      string    `json:"email"`
+	ShortID    string    `json:"shortId"`
+	AssignedAt time.Time `json:"assignedAt"`
+}
+
+// ShortIDStore keeps the REALITY shortIds assigned to users, keyed by inbound tag and email.
+// Put and List come from keyedStore; Get and Delete take the tag and email the key is built from.
+type ShortIDStore struct {
+	*keyedStore[ShortID]
+}
+
+// shortIDKey keys an assignment by tag, then email, so that listing orders them that way.
+func shortIDKey(tag, email string) string {
+	return tag + "\x00" + email
+}
+
+func openShortIDStore(path string) (*ShortIDStore, error) {
+	s, err := openKeyedStore(path, func(sid ShortID) string { return shortIDKey(sid.Tag, sid.Email) })
+	if err != nil {
+		return nil, err
+	}
+	return &ShortIDStore{s}, nil
+}
+
+// Get returns the shortId assigned to a user on an inbound, if any.
+func (s *ShortIDStore) Get(tag, email string) (ShortID, bool) {
+	return s.keyedStore.Get(shortIDKey(tag, email))
+}
+
+// Delete removes the assignments of users on an inbound and persists the store.
+func (s *ShortIDStore) Delete(tag string, emails ...string) error {
+	keys := make([]string, len(emails))
+	for i, email := range emails {
+		keys[i] = shortIDKey(tag, email)
+	}
+	return s.keyedStore.Delete(keys...)
+}
+
+// DeleteTag removes every assignment on an inbound and persists the store.
+func (s *ShortIDStore) DeleteTag(tag string) error {
+	var keys []string
+	for _, sid := range s.ListByTag(tag) {
+		keys = append(keys, shortIDKey(sid.Tag, sid.Email))
+	}
+	return s.keyedStore.Delete(keys...)
+}
+
+// DeleteEmail removes every assignment of a user and persists the store.
+func (s *ShortIDStore) DeleteEmail(email string) error {
+	var keys []string
+	for _, sid := range s.ListByEmail(email) {
+		keys = append(keys, shortIDKey(sid.Tag, sid.Email))
+	}
+	return s.keyedStore.Delete(keys...)
+}
+
+// ListByTag returns the assignments of a single inbound ordered by email.
+func (s *ShortIDStore) ListByTag(tag string) []ShortID {
+	return s.Filter(func(sid ShortID) bool { return sid.Tag == tag })
+}
+
+// ListByEmail returns the assignments of a single user ordered by tag.
+func (s *ShortIDStore) ListByEmail(email string) []ShortID {
+	return s.Filter(func(sid ShortID) bool { return sid.Email == email })
+}
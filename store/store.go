@@ -0,0 +1,140 @@
+// Package store persists the state the bridge manages on top of Xray-core,
+// so that it can be replayed whenever Xray-core loses its in-memory configuration.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Store groups all on-disk stores kept by the bridge.
+type Store struct {
+	Users     *UserStore
+	Inbounds  *ObjectStore
+	Outbounds *ObjectStore
+	Rules     *ObjectStore
+
+	Quotas       *QuotaStore
+	Expiries     *ExpiryStore
+	DeviceLimits *DeviceLimitStore
+	Suspensions  *SuspensionStore
+
+	History *HistoryStore
+
+	SubscriptionTokens *SubscriptionTokenStore
+	ShortIDs           *ShortIDStore
+}
+
+// Open opens (or creates) every store inside the given data directory.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create data directory %s: %w", dir, err)
+	}
+
+	users, err := openUserStore(filepath.Join(dir, "users.json"))
+	if err != nil {
+		return nil, err
+	}
+	inbounds, err := openObjectStore(filepath.Join(dir, "inbounds.json"))
+	if err != nil {
+		return nil, err
+	}
+	outbounds, err := openObjectStore(filepath.Join(dir, "outbounds.json"))
+	if err != nil {
+		return nil, err
+	}
+	rules, err := openObjectStore(filepath.Join(dir, "rules.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	quotas, err := openQuotaStore(filepath.Join(dir, "quotas.json"))
+	if err != nil {
+		return nil, err
+	}
+	expiries, err := openExpiryStore(filepath.Join(dir, "expiries.json"))
+	if err != nil {
+		return nil, err
+	}
+	suspensions, err := openSuspensionStore(filepath.Join(dir, "suspensions.json"))
+	if err != nil {
+		return nil, err
+	}
+	deviceLimits, err := openDeviceLimitStore(filepath.Join(dir, "device_limits.json"))
+	if err != nil {
+		return nil, err
+	}
+	history, err := openHistoryStore(filepath.Join(dir, "history"))
+	if err != nil {
+		return nil, err
+	}
+	subscriptionTokens, err := openSubscriptionTokenStore(filepath.Join(dir, "subscription_tokens.json"))
+	if err != nil {
+		return nil, err
+	}
+	shortIDs, err := openShortIDStore(filepath.Join(dir, "short_ids.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		Users:        users,
+		Inbounds:     inbounds,
+		Outbounds:    outbounds,
+		Rules:        rules,
+		Quotas:       quotas,
+		Expiries:     expiries,
+		Suspensions:  suspensions,
+		DeviceLimits: deviceLimits,
+		History:      history,
+
+		SubscriptionTokens: subscriptionTokens,
+		ShortIDs:           shortIDs,
+	}, nil
+}
+
+// readJSON decodes the JSON file at path into v. A missing file is not an error.
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("could not decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSON atomically replaces the file at path with the JSON encoding of v.
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"time"
+)
+
+// SubscriptionToken is the opaque token a user fetches their subscription with, in place of
+// their proxy credentials. Rotating or revoking it leaves the user's accounts untouched.
+type SubscriptionToken struct {
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SubscriptionTokenStore keeps the subscription token of each user, keyed by email.
+type SubscriptionTokenStore struct {
+	*keyedStore[SubscriptionToken]
+	// byToken indexes the emails by the SHA-256 of their token, so the time a lookup takes does
+	// not depend on how much of a guessed token matches. It is guarded by mu.
+	byToken map[[sha256.Size]byte]string
+}
+
+func openSubscriptionTokenStore(path string) (*SubscriptionTokenStore, error) {
+	s, err := openKeyedStore(path, func(t SubscriptionToken) string { return t.Email })
+	if err != nil {
+		return nil, err
+	}
+	byToken := make(map[[sha256.Size]byte]string, len(s.items))
+	for email, t := range s.items {
+		byToken[sha256.Sum256([]byte(t.Token))] = email
+	}
+	return &SubscriptionTokenStore{s, byToken}, nil
+}
+
+// Put adds or replaces the tokens of the given users and persists the store. The previous token
+// of a user stops resolving.
+func (s *SubscriptionTokenStore) Put(tokens ...SubscriptionToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range tokens {
+		if old, ok := s.items[t.Email]; ok {
+			delete(s.byToken, sha256.Sum256([]byte(old.Token)))
+		}
+		s.items[t.Email] = t
+		s.byToken[sha256.Sum256([]byte(t.Token))] = t.Email
+	}
+	return s.save()
+}
+
+// Delete removes the tokens of the given users and persists the store. Nothing is written when
+// none of them have a token.
+func (s *SubscriptionTokenStore) Delete(emails ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := false
+	for _, email := range emails {
+		if t, ok := s.items[email]; ok {
+			delete(s.byToken, sha256.Sum256([]byte(t.Token)))
+			delete(s.items, email)
+			deleted = true
+		}
+	}
+	if !deleted {
+		return nil
+	}
+	return s.save()
+}
+
+// Lookup returns the subscription token matching the given token value, if any.
+func (s *SubscriptionTokenStore) Lookup(token string) (SubscriptionToken, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	email, ok := s.byToken[sha256.Sum256([]byte(token))]
+	if !ok {
+		return SubscriptionToken{}, false
+	}
+	t := s.items[email]
+	if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) != 1 {
+		return SubscriptionToken{}, false
+	}
+	return t, true
+}
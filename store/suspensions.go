@@ -0,0 +1,48 @@
+package store
+
+import "time"
+
+// SuspendedAccount is a copy of a user account removed from an inbound while its user is suspended.
+type SuspendedAccount struct {
+	Tag string `json:"tag"`
+	// User is the protobuf encoding of the xray-core protocol.User, so it can be added back unchanged.
+	User []byte `json:"user"`
+}
+
+// Suspension records a user that has been taken out of every inbound, and why.
+// The user is only put back once every reason has been lifted.
+type Suspension struct {
+	Email       string             `json:"email"`
+	Reasons     []string           `json:"reasons"`
+	SuspendedAt time.Time          `json:"suspendedAt"`
+	Accounts    []SuspendedAccount `json:"accounts"`
+}
+
+// HasReason reports whether the suspension holds the given reason.
+func (s Suspension) HasReason(reason string) bool {
+	for _, r := range s.Reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// SuspensionStore keeps the suspended users, keyed by email.
+type SuspensionStore struct {
+	*keyedStore[Suspension]
+}
+
+func openSuspensionStore(path string) (*SuspensionStore, error) {
+	s, err := openKeyedStore(path, func(v Suspension) string { return v.Email })
+	if err != nil {
+		return nil, err
+	}
+	return &SuspensionStore{s}, nil
+}
+
+// IsSuspended reports whether a user is currently suspended for any reason.
+func (s *SuspensionStore) IsSuspended(email string) bool {
+	_, ok := s.Get(email)
+	return ok
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// User is an inbound user managed by the bridge.
+type User struct {
+	Tag      string `json:"tag"`
+	Email    string `json:"email"`
+	ID       string `json:"id,omitempty"`
+	Flow     string `json:"flow,omitempty"`
+	Level    uint32 `json:"level"`
+	Protocol string `json:"protocol"`
+	Security string `json:"security,omitempty"`
+	Password string `json:"password,omitempty"`
+	Method   string `json:"method,omitempty"`
+}
+
+// UserStore keeps every user the bridge has pushed into Xray-core, keyed by inbound tag and email.
+type UserStore struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]map[string]User
+}
+
+func openUserStore(path string) (*UserStore, error) {
+	var users []User
+	if err := readJSON(path, &users); err != nil {
+		return nil, err
+	}
+
+	s := &UserStore{
+		path:  path,
+		users: make(map[string]map[string]User),
+	}
+	for _, u := range users {
+		s.put(u)
+	}
+	return s, nil
+}
+
+// Put adds or replaces the given users and persists the store.
+func (s *UserStore) Put(users ...User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range users {
+		s.put(u)
+	}
+	return s.save()
+}
+
+// Delete removes the users with the given emails from an inbound and persists the store.
+func (s *UserStore) Delete(tag string, emails ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, email := range emails {
+		delete(s.users[tag], email)
+	}
+	if len(s.users[tag]) == 0 {
+		delete(s.users, tag)
+	}
+	return s.save()
+}
+
+// DeleteTag removes every user of an inbound and persists the store.
+func (s *UserStore) DeleteTag(tag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[tag]; !ok {
+		return nil
+	}
+	delete(s.users, tag)
+	return s.save()
+}
+
+// ReplaceTag replaces every stored user of an inbound with the given users and persists the store.
+func (s *UserStore) ReplaceTag(tag string, users ...User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, tag)
+	for _, u := range users {
+		u.Tag = tag
+		s.put(u)
+	}
+	return s.save()
+}
+
+// List returns all stored users ordered by tag and email.
+func (s *UserStore) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.list()
+}
+
+// ListByTag returns the stored users of a single inbound ordered by email.
+func (s *UserStore) ListByTag(tag string) []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users[tag]))
+	for _, u := range s.users[tag] {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users
+}
+
+func (s *UserStore) put(u User) {
+	if s.users[u.Tag] == nil {
+		s.users[u.Tag] = make(map[string]User)
+	}
+	s.users[u.Tag][u.Email] = u
+}
+
+func (s *UserStore) list() []User {
+	var users []User
+	for _, byEmail := range s.users {
+		for _, u := range byEmail {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Tag != users[j].Tag {
+			return users[i].Tag < users[j].Tag
+		}
+		return users[i].Email < users[j].Email
+	})
+	return users
+}
+
+func (s *UserStore) save() error {
+	users := s.list()
+	if users == nil {
+		users = []User{}
+	}
+	return writeJSON(s.path, users)
+}
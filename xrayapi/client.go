@@ -3,6 +3,8 @@ package xrayapi
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -20,6 +22,9 @@ type Client struct {
 	HandlerClient proxyman_command.HandlerServiceClient
 	RouterClient router_command.RoutingServiceClient
 	StatsClient stats_command.StatsServiceClient
+
+	mu          sync.RWMutex
+	lastRestart time.Time
 }
 
 // NewClient creates a new Xray gRPC client.
@@ -0,0 +1,95 @@
+package xrayapi
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+
+	stats_command "github.com/xtls/xray-core/app/stats/command"
+)
+
+// RestartEvent describes a fresh Xray-core process observed by the watcher.
+type RestartEvent struct {
+	DetectedAt     time.Time
+	PreviousUptime uint32
+	Uptime         uint32
+}
+
+// Watch polls Xray-core every interval until ctx is done and calls onRestart whenever
+// a new Xray-core process is detected, either because its uptime dropped or because it
+// came back from a lost connection with an uptime shorter than the outage.
+func (c *Client) Watch(ctx context.Context, interval time.Duration, onRestart func(RestartEvent)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastUptime uint32
+	var lastSeen time.Time
+	disconnected := false
+
+	for {
+		state := c.conn.GetState()
+		if state == connectivity.TransientFailure || state == connectivity.Shutdown {
+			disconnected = true
+		}
+
+		pollCtx, cancel := context.WithTimeout(ctx, interval)
+		resp, err := c.StatsClient.GetSysStats(pollCtx, &stats_command.SysStatsRequest{})
+		cancel()
+
+		if err != nil {
+			if !disconnected {
+				log.Printf("Lost contact with Xray-core (state %s): %v", state, err)
+			}
+			disconnected = true
+		} else {
+			now := time.Now()
+			uptime := resp.GetUptime()
+
+			restarted := false
+			switch {
+			case lastSeen.IsZero():
+				// Xray-core only became reachable after the bridge started
+				restarted = disconnected
+			case uptime < lastUptime:
+				restarted = true
+			case disconnected:
+				restarted = time.Duration(uptime)*time.Second < now.Sub(lastSeen)
+			}
+
+			if restarted {
+				event := RestartEvent{
+					DetectedAt:     now,
+					PreviousUptime: lastUptime,
+					Uptime:         uptime,
+				}
+				c.mu.Lock()
+				c.lastRestart = now
+				c.mu.Unlock()
+
+				log.Printf("Xray-core restart detected (uptime %ds, previously %ds)", uptime, lastUptime)
+				if onRestart != nil {
+					onRestart(event)
+				}
+			} else if disconnected {
+				log.Printf("Reconnected to Xray-core")
+			}
+
+			lastUptime, lastSeen, disconnected = uptime, now, false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LastRestart returns when the watcher last saw Xray-core restart, or the zero time if it never did.
+func (c *Client) LastRestart() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastRestart
+}